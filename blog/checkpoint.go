@@ -0,0 +1,346 @@
+package blog
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/dates"
+	"github.com/bobbytrapz/hinatazaka/internal/file"
+)
+
+// UseCheckpoint is the context key for the checkpoint a crawl should keep
+type UseCheckpoint struct{}
+
+// CheckpointDir is the directory in the config directory with a checkpoint for each place we save to
+const CheckpointDir = "checkpoints"
+
+// CheckpointPath for crawls that save blogs to saveTo
+// each save_to has its own checkpoint so crawls to different places do not mix
+func CheckpointPath(configPath string, saveTo string) string {
+	abs, err := filepath.Abs(saveTo)
+	if err != nil {
+		abs = saveTo
+	}
+	sum := sha1.Sum([]byte(abs))
+	return filepath.Join(configPath, CheckpointDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// checkpointCompactEvery is how many updates we append to the log
+// before we write them into the checkpoint and start a new log
+const checkpointCompactEvery = 1000
+
+// HasCheckpoint is true if a crawl to saveTo was stopped
+func HasCheckpoint(configPath string, saveTo string) bool {
+	_, err := os.Stat(CheckpointPath(configPath, saveTo))
+	return err == nil
+}
+
+// Checkpoint records enough about a crawl on disk so we can resume it
+// each update is appended to a log next to the checkpoint so we do not write
+// the whole checkpoint for every blog and the log is folded into it every so often
+type Checkpoint struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until,omitempty"`
+	// SinceLast crawls start from the newest blog we saved for each member
+	SinceLast bool              `json:"since_last,omitempty"`
+	SaveTo    string            `json:"save_to"`
+	MaxSaved  int               `json:"max_saved"`
+	Crawls    map[string]*Crawl `json:"crawls"`
+
+	path string
+	mu   sync.Mutex
+	// log of updates since the checkpoint was written
+	log    *os.File
+	logged int
+}
+
+// Crawl is the state of one member's blog list spider
+// a list page is only visited once every blog on it is saved
+// so a blog we were saving when we stopped is saved when we resume
+type Crawl struct {
+	Member string `json:"member"`
+	// Frontier has list pages we found but have not finished
+	Frontier map[string]bool `json:"frontier"`
+	// Visited has list pages where every blog was handled
+	Visited map[string]bool `json:"visited"`
+	// Saved has blogs we finished saving
+	Saved map[string]bool `json:"saved"`
+}
+
+// update to a crawl as it is kept in the log
+type update struct {
+	Root  string `json:"root"`
+	Found string `json:"found,omitempty"`
+	Visit string `json:"visit,omitempty"`
+	Saved string `json:"saved,omitempty"`
+}
+
+func (u update) apply(c *Crawl) {
+	if u.Found != "" && !c.Visited[u.Found] {
+		c.Frontier[u.Found] = true
+	}
+	if u.Visit != "" {
+		delete(c.Frontier, u.Visit)
+		c.Visited[u.Visit] = true
+	}
+	if u.Saved != "" {
+		c.Saved[u.Saved] = true
+	}
+}
+
+// NewCheckpoint that is saved to path
+func NewCheckpoint(path string, within dates.Range, saveTo string, maxSaved int) *Checkpoint {
+	return &Checkpoint{
+		Since:    within.From,
+		Until:    within.Until,
+		SaveTo:   saveTo,
+		MaxSaved: maxSaved,
+		Crawls:   make(map[string]*Crawl),
+		path:     path,
+	}
+}
+
+// LoadCheckpoint we saved to path
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("There is no crawl to resume")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("blog.LoadCheckpoint: %w", err)
+	}
+
+	cp := &Checkpoint{path: path}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("blog.LoadCheckpoint: %w", err)
+	}
+	if cp.Crawls == nil {
+		cp.Crawls = make(map[string]*Crawl)
+	}
+
+	if err := cp.replay(); err != nil {
+		return nil, fmt.Errorf("blog.LoadCheckpoint: %w", err)
+	}
+
+	return cp, nil
+}
+
+// replay the updates in the log and fold them into the checkpoint
+// we may have stopped while writing the last update so we stop at the first we cannot read
+func (cp *Checkpoint) replay() error {
+	f, err := os.Open(cp.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var u update
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			break
+		}
+		if c, ok := cp.Crawls[u.Root]; ok {
+			u.apply(c)
+		}
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.write()
+
+	return nil
+}
+
+// logPath is next to the checkpoint
+func (cp *Checkpoint) logPath() string {
+	return strings.TrimSuffix(cp.path, ".json") + ".log"
+}
+
+// Begin a crawl for a member starting from root
+// if we are resuming then the crawl is kept as it was
+func (cp *Checkpoint) Begin(member string, root string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if _, ok := cp.Crawls[root]; ok {
+		return
+	}
+	cp.Crawls[root] = &Crawl{
+		Member:   member,
+		Frontier: map[string]bool{root: true},
+		Visited:  make(map[string]bool),
+		Saved:    make(map[string]bool),
+	}
+	cp.write()
+}
+
+// Frontier of a crawl along with the pages we already visited
+func (cp *Checkpoint) Frontier(root string) (frontier []string, visited []string) {
+	if cp == nil {
+		return []string{root}, nil
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	c, ok := cp.Crawls[root]
+	if !ok {
+		return []string{root}, nil
+	}
+	for p := range c.Frontier {
+		frontier = append(frontier, p)
+	}
+	for p := range c.Visited {
+		visited = append(visited, p)
+	}
+	if len(frontier) == 0 {
+		frontier = []string{root}
+	}
+
+	return
+}
+
+// Found a list page
+func (cp *Checkpoint) Found(root string, page string) {
+	cp.update(update{Root: root, Found: page})
+}
+
+// Visit finished for a list page
+func (cp *Checkpoint) Visit(root string, page string) {
+	cp.update(update{Root: root, Visit: page})
+}
+
+// Save finished for a blog
+// failed blogs are not recorded so we try them again when we resume
+func (cp *Checkpoint) Save(root string, link string, ok bool) {
+	if !ok {
+		return
+	}
+	cp.update(update{Root: root, Saved: link})
+}
+
+// IsSaved is true if we already saved a blog
+func (cp *Checkpoint) IsSaved(root string, link string) bool {
+	if cp == nil {
+		return false
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	c, ok := cp.Crawls[root]
+	return ok && c.Saved[link]
+}
+
+// Done with a crawl so we forget it
+// once every crawl is done the checkpoint file is removed
+func (cp *Checkpoint) Done(root string) {
+	if cp == nil {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	delete(cp.Crawls, root)
+	if len(cp.Crawls) == 0 {
+		cp.closeLog()
+		for _, path := range []string{cp.path, cp.logPath()} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Println("[nok]", err)
+			}
+		}
+		return
+	}
+	cp.write()
+}
+
+func (cp *Checkpoint) update(u update) {
+	if cp == nil {
+		return
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	c, ok := cp.Crawls[u.Root]
+	if !ok {
+		return
+	}
+	u.apply(c)
+	cp.append(u)
+}
+
+// append an update to the log or write the checkpoint once the log is long
+// we must hold the lock
+func (cp *Checkpoint) append(u update) {
+	if cp.logged >= checkpointCompactEvery {
+		cp.write()
+		return
+	}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		fmt.Println("[nok]", err)
+		return
+	}
+	if cp.log == nil {
+		f, err := os.OpenFile(cp.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Println("[nok]", err)
+			return
+		}
+		cp.log = f
+	}
+	if _, err := cp.log.Write(append(data, '\n')); err != nil {
+		fmt.Println("[nok]", err)
+		return
+	}
+	cp.logged++
+}
+
+// write the checkpoint with every update so far and start a new log
+// we must hold the lock
+func (cp *Checkpoint) write() {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		fmt.Println("[nok]", err)
+		return
+	}
+	if err := file.Write(cp.path, data, 0600); err != nil {
+		// the log still has what we could not write
+		fmt.Println("[nok]", err)
+		return
+	}
+
+	cp.closeLog()
+	if err := os.Remove(cp.logPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("[nok]", err)
+	}
+	cp.logged = 0
+}
+
+// closeLog if it is open
+// we must hold the lock
+func (cp *Checkpoint) closeLog() {
+	if cp.log == nil {
+		return
+	}
+	if err := cp.log.Close(); err != nil {
+		fmt.Println("[nok]", err)
+	}
+	cp.log = nil
+}
@@ -0,0 +1,202 @@
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/dates"
+	"github.com/bobbytrapz/hinatazaka/internal/file"
+)
+
+// IndexFilename is the name of the index in each member's directory
+const IndexFilename = "index.json"
+
+// Index of a member's archive
+type Index struct {
+	Member string `json:"member"`
+	// Posts we saved by link
+	Posts map[string]Post `json:"posts"`
+	// LastPosted is when the newest post we saved was posted
+	LastPosted time.Time `json:"last_posted,omitempty"`
+	// Complete is true once we saved every blog the member posted
+	Complete bool `json:"complete"`
+	// Frozen archives will not change since the member graduated
+	Frozen   bool      `json:"frozen"`
+	FrozenAt time.Time `json:"frozen_at,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Post we saved
+type Post struct {
+	Title   string    `json:"title"`
+	Posted  time.Time `json:"posted"`
+	Path    string    `json:"path"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// indexes we opened by path so everyone saving a member shares one
+var indexes = struct {
+	sync.Mutex
+	m map[string]*Index
+}{m: make(map[string]*Index)}
+
+// OpenIndex of a member's archive in saveTo
+// the index is empty if we never saved anything for the member
+func OpenIndex(saveTo string, member string) (*Index, error) {
+	path := filepath.Join(saveTo, member, IndexFilename)
+
+	indexes.Lock()
+	defer indexes.Unlock()
+
+	if ix, ok := indexes.m[path]; ok {
+		return ix, nil
+	}
+
+	ix := &Index{
+		Member: member,
+		Posts:  make(map[string]Post),
+		path:   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blog.OpenIndex: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, ix); err != nil {
+			return nil, fmt.Errorf("blog.OpenIndex: %s: %w", path, err)
+		}
+		if ix.Posts == nil {
+			ix.Posts = make(map[string]Post)
+		}
+		// indexes from before we kept track of the newest post
+		for _, p := range ix.Posts {
+			if p.Posted.After(ix.LastPosted) {
+				ix.LastPosted = p.Posted
+			}
+		}
+	}
+
+	indexes.m[path] = ix
+
+	return ix, nil
+}
+
+// Add a post we saved
+func (ix *Index) Add(link string, p Post) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.Posts[link] = p
+	if p.Posted.After(ix.LastPosted) {
+		ix.LastPosted = p.Posted
+	}
+	return ix.save()
+}
+
+// Has is true if we saved the post at link
+func (ix *Index) Has(link string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	_, ok := ix.Posts[link]
+	return ok
+}
+
+// Latest is when the newest post we saved was posted or the zero time if we saved nothing
+func (ix *Index) Latest() time.Time {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.LastPosted
+}
+
+// LatestOnDisk is the newest day we saved a blog to a member's directory or the zero time
+// archives from before we kept an index only have a directory for each day
+func LatestOnDisk(saveTo string, member string) time.Time {
+	dir := filepath.Join(saveTo, member)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var latest time.Time
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", e.Name(), dates.Tokyo)
+		if err != nil || !day.After(latest) {
+			continue
+		}
+		// a directory without a blog in it was never finished
+		if found, _ := filepath.Glob(filepath.Join(dir, e.Name(), "*.mhtml")); len(found) == 0 {
+			continue
+		}
+		latest = day
+	}
+
+	return latest
+}
+
+// MarkComplete once every blog is saved
+func (ix *Index) MarkComplete() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.Complete = true
+	return ix.save()
+}
+
+// Freeze the archive of a member who graduated
+func (ix *Index) Freeze() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.Frozen = true
+	ix.FrozenAt = time.Now()
+	return ix.save()
+}
+
+// IsComplete is true once every blog is saved
+func (ix *Index) IsComplete() bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.Complete
+}
+
+// IsFrozen is true if the archive will not change
+func (ix *Index) IsFrozen() bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.Frozen
+}
+
+// we must hold the lock
+func (ix *Index) save() error {
+	data, err := json.MarshalIndent(ix, "", "  ")
+	if err != nil {
+		return err
+	}
+	return file.Write(ix.path, data, 0644)
+}
+
+// isIndexed is true if a member's index has the post at link
+func isIndexed(saveTo string, member string, link string) bool {
+	ix, err := OpenIndex(saveTo, member)
+	if err != nil {
+		log.Printf("blog: %s", err)
+		return false
+	}
+	return ix.Has(link)
+}
@@ -31,6 +31,18 @@ var jsBlogImages = `
 };
 `
 
+// removes scripts and everything around the article before we take a snapshot
+// we keep the head so the article keeps its style
+var jsStripPage = `
+() => {
+	document.querySelectorAll("script, noscript, iframe, link[rel=preload], link[rel=prefetch]").forEach(el => el.remove());
+	const article = document.querySelector(".p-blog-article");
+	if (article) {
+		document.body.replaceChildren(article);
+	}
+};
+`
+
 // each member has a page that lists all of their blogs
 // this extracts the individual blog links from that page
 // we can get the member's name and date posted with a bit more work
@@ -0,0 +1,123 @@
+package blog
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/browser"
+	"github.com/bobbytrapz/hinatazaka/fetch"
+	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// routers handling requests for each page we opened
+var routers sync.Map
+
+// newPage opens a page that blocks the requests we do not need
+// and loads documents with our own client so they are cached and polite
+// when we are offline everything the page needs comes from the cache
+func newPage() (*rod.Page, error) {
+	page, err := browser.Page()
+	if err != nil {
+		return nil, fmt.Errorf("blog.newPage: %s", err)
+	}
+
+	var blockURLs []*regexp.Regexp
+	for _, pattern := range options.GetStringSlice("block_urls") {
+		blockURLs = append(blockURLs, regexp.MustCompile(proto.PatternToReg(pattern)))
+	}
+	blockTypes := make(map[proto.NetworkResourceType]bool)
+	for _, t := range options.GetStringSlice("block_resource_types") {
+		blockTypes[proto.NetworkResourceType(t)] = true
+	}
+
+	// rod calls the first handler whose pattern matches the url
+	// so every pattern uses this same handler and it decides what to do
+	route := func(h *rod.Hijack) {
+		if blockTypes[h.Request.Type()] {
+			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+			return
+		}
+		link := h.Request.URL().String()
+		for _, re := range blockURLs {
+			if re.MatchString(link) {
+				h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+				return
+			}
+		}
+		if err := h.LoadResponse(httpClient(), true); err != nil {
+			log.Printf("blog: load: %s", err)
+			h.Response.Fail(proto.NetworkErrorReasonFailed)
+		}
+	}
+
+	// chrome only pauses requests that match one of these
+	router := page.HijackRequests()
+	add := func(pattern string, t proto.NetworkResourceType) {
+		if err := router.Add(pattern, t, route); err != nil {
+			log.Printf("blog.newPage: hijack %q %q: %s", pattern, t, err)
+		}
+	}
+	for _, pattern := range options.GetStringSlice("block_urls") {
+		add(pattern, "")
+	}
+	for t := range blockTypes {
+		add("*", t)
+	}
+	if fetch.Offline {
+		add("*", "")
+	} else {
+		add("*", proto.NetworkResourceTypeDocument)
+	}
+	go router.Run()
+
+	routers.Store(page, router)
+
+	return page, nil
+}
+
+// getPage from pool or open a new one
+// the page is nil if we could not open one and still goes back in the pool
+func getPage(pool rod.PagePool) (page *rod.Page, err error) {
+	page = pool.Get(func() *rod.Page {
+		var p *rod.Page
+		p, err = newPage()
+		return p
+	})
+	return
+}
+
+// closePage stops blocking requests and closes the page
+// the page may be gone with chrome so we do not mind if this fails
+func closePage(page *rod.Page) {
+	if r, ok := routers.LoadAndDelete(page); ok {
+		_ = r.(*rod.HijackRouter).Stop()
+	}
+	_ = page.Close()
+}
+
+// renew a page that belongs to chrome from before it was started again
+func renew(page *rod.Page) (*rod.Page, error) {
+	if _, err := browser.Get(); err != nil {
+		return page, err
+	}
+	if browser.Is(page.Browser()) {
+		return page, nil
+	}
+	closePage(page)
+	return newPage()
+}
+
+// navigate to link and wait for the page to load
+// the document is loaded by httpClient which waits for its turn with the host
+func navigate(page *rod.Page, link string, timeout time.Duration) error {
+	p := page.Timeout(timeout)
+	if err := p.Navigate(link); err != nil {
+		return err
+	}
+	return p.WaitLoad()
+}
@@ -15,49 +15,43 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/bobbytrapz/hinatazaka/dates"
+	"github.com/bobbytrapz/hinatazaka/fetch"
+	"github.com/bobbytrapz/hinatazaka/members"
 	"github.com/bobbytrapz/hinatazaka/options"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/go-rod/rod/lib/utils"
 )
 
-var browser *rod.Browser
-
-var openBrowserOnce sync.Once
-
-func openBrowser() {
-	log.Print("blog: Opening browser...")
-	browser = rod.New().MustConnect()
-}
-
-func SaveBlogsSince(ctx context.Context, root string, since time.Time, saveTo string, maxSaved uint64) error {
-	openBrowserOnce.Do(openBrowser)
-
+func SaveBlogsSince(ctx context.Context, root string, within dates.Range, saveTo string, maxSaved uint64) error {
 	visit := make(chan string)
 	var visited sync.Map
 	var failed sync.Map
-
-	// use tokyo time
-	loc, err := time.LoadLocation("Asia/Tokyo")
-	if err != nil {
-		panic(err)
+	var authors sync.Map
+
+	// we keep a checkpoint so the crawl can be resumed
+	cp, _ := ctx.Value(UseCheckpoint{}).(*Checkpoint)
+	_, skipSaved := ctx.Value(SkipSaved{}).(struct{})
+	frontier, done := cp.Frontier(root)
+	for _, p := range done {
+		visited.Store(p, p)
 	}
 
-	poolCount := 8
+	poolCount := options.GetInt("pages")
 	pool := rod.NewPagePool(poolCount)
-	createFn := func() *rod.Page {
-		return browser.MustPage().MustSetUserAgent(&proto.NetworkSetUserAgentOverride{
-			UserAgent: options.Get("user_agent"),
-		})
-	}
 
 	var count atomic.Uint64
 
-	timeout := time.NewTimer(WaitForSpiderTimeout)
+	spiderTimeout := options.GetDuration("spider_timeout")
+	timeout := time.NewTimer(spiderTimeout)
 
 	job := func() error {
-		page := pool.Get(createFn)
-		defer pool.Put(page)
+		page, err := getPage(pool)
+		defer func() { pool.Put(page) }()
+		if err != nil {
+			return err
+		}
 
 		for {
 			select {
@@ -69,17 +63,22 @@ func SaveBlogsSince(ctx context.Context, root string, since time.Time, saveTo st
 				if _, ok := visited.Load(link); ok {
 					continue
 				}
+				if page, err = renew(page); err != nil {
+					// the link was not visited so we visit it again when we resume
+					return err
+				}
 
 				// we found a page so reset timeout
 				if timeout.Stop() {
-					timeout.Reset(WaitForSpiderTimeout)
+					timeout.Reset(spiderTimeout)
 				}
 
 				visited.Store(link, link)
 				log.Printf("blog: visit: %q", link)
 
-				err = page.Timeout(WaitForSpiderTimeout).MustNavigate(link).WaitLoad()
+				err := navigate(page, link, options.GetDuration("blog_list_timeout"))
 				if err != nil {
+					log.Printf("blog.SaveBlogsSince: %s", err)
 					// delete so we can maybe try again
 					visited.Delete(link)
 					continue
@@ -94,66 +93,129 @@ func SaveBlogsSince(ctx context.Context, root string, since time.Time, saveTo st
 
 				// add more pages to visit
 				for _, blogPage := range blogs.Pages {
+					cp.Found(root, blogPage)
 					go func(p string) {
 						visit <- p
 					}(blogPage)
 				}
 
 				// download blogs
+				// a page with a failed blog is visited again when we resume
+				pageSaved := true
 				for _, b := range blogs.Blogs {
-					if count.Load() >= maxSaved {
-						log.Print("blog.SaveBlogsSince: reached max blog save count")
+					if ctx.Err() != nil {
+						// we stop between blogs and visit this page again when we resume
 						return nil
 					}
-					count.Add(1)
+
+					if cp.IsSaved(root, b.Link) {
+						continue
+					}
 
 					// the blogs are found in reverse chronological order so
 					// I think this should work
-					at := time.Date(b.Year, b.Month, b.Day, 23, 59, 59, 0, loc)
-					if at.Before(since) {
+					day := time.Date(b.Year, b.Month, b.Day, 0, 0, 0, 0, dates.Tokyo)
+					if !within.From.IsZero() && day.Before(within.From) {
 						log.Print("blog.SaveBlogsSince: found oldest blog")
 						break
 					}
+					if !within.Contains(day) {
+						// newer than we want
+						continue
+					}
+					at := time.Date(b.Year, b.Month, b.Day, 23, 59, 59, 0, dates.Tokyo)
+
+					// the site may write a member's name with a space or variant kanji
+					author := members.RealName(b.Name)
+					if skipSaved && isIndexed(saveTo, author, b.Link) {
+						continue
+					}
+
+					if count.Load() >= maxSaved {
+						log.Print("blog.SaveBlogsSince: reached max blog save count")
+						return nil
+					}
+					count.Add(1)
 
-					// if there is space between this member's names remove it
-					author := strings.ReplaceAll(b.Name, " ", "")
+					authors.Store(author, true)
 					blogLink := b.Link
 					blogTitle := b.Title
 
 					// save a blog
-					err = saveBlogFromPage(ctx, page, blogLink, blogTitle, author, at, saveTo)
+					err := saveBlogFromPage(ctx, page, blogLink, blogTitle, author, at, saveTo)
 					if err != nil {
 						log.Printf("blog.SaveBlogsSince: saveBlogFromPage: %s", err)
 						failed.Store(b.Link, b.Link)
+						pageSaved = false
 					}
+					cp.Save(root, blogLink, err == nil)
+				}
+
+				if pageSaved {
+					cp.Visit(root, link)
 				}
 			}
 		}
 	}
 
 	// spider
+	// a page that stops working stops its job and the rest carry on
+	errs := make(chan error, poolCount)
 	var wg sync.WaitGroup
 	for i := 0; i < poolCount; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			if err := job(); err != nil {
-				panic(err)
+				errs <- err
 			}
 		}()
 	}
 
 	// initialize spider
-	visit <- root
+	for _, p := range frontier {
+		go func(p string) {
+			visit <- p
+		}(p)
+	}
 
 	// give spider some time to start
-	<-time.After(WaitForBlogDownload)
+	select {
+	case <-ctx.Done():
+	case <-time.After(spiderTimeout):
+	}
 
 	wg.Wait()
+	close(errs)
+	// the first problem is enough to say why we stopped
+	jobErr := <-errs
+
+	if ctx.Err() == nil && jobErr == nil {
+		// we finished so there is nothing to resume
+		cp.Done(root)
+	}
 
-	pool.Cleanup(func(p *rod.Page) {
-		p.MustClose()
+	// we have every blog if we went back forever without a problem
+	_, dryRun := ctx.Value(ShouldDryRun{}).(struct{})
+	hasFailed := false
+	failed.Range(func(k, v interface{}) bool {
+		hasFailed = true
+		return false
 	})
+	if within.From.IsZero() && within.Until.IsZero() && ctx.Err() == nil && jobErr == nil && !dryRun && !hasFailed && count.Load() < maxSaved {
+		authors.Range(func(k, v interface{}) bool {
+			ix, err := OpenIndex(saveTo, k.(string))
+			if err == nil {
+				err = ix.MarkComplete()
+			}
+			if err != nil {
+				log.Printf("blog.SaveBlogsSince: %s", err)
+			}
+			return true
+		})
+	}
+
+	pool.Cleanup(closePage)
 
 	visited.Range(func(k, v interface{}) bool {
 		fmt.Println("[visited]", v.(string))
@@ -165,71 +227,144 @@ func SaveBlogsSince(ctx context.Context, root string, since time.Time, saveTo st
 	})
 	fmt.Println("[saved]", count.Load(), "blogs")
 
+	if jobErr != nil {
+		return fmt.Errorf("blog.SaveBlogsSince: %s", jobErr)
+	}
+
 	return nil
 }
 
-func SaveBlogsOn(ctx context.Context, authorShouldSave map[string]bool, on time.Time, saveTo string, maxSaved int) error {
-	openBrowserOnce.Do(openBrowser)
+// DayListURL lists every member's blogs posted on a day given as 20190327
+const DayListURL = "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&dy=%s"
 
-	dy := fmt.Sprintf("%04d%02d%02d", on.Year(), on.Month(), on.Day())
-	listPage := fmt.Sprintf("https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&dy=%s", dy)
+// SaveBlogsOn saves blogs posted on any of the days by visiting the list the site has for each day
+// this is quicker than visiting each member's list when we want many members over a few days
+func SaveBlogsOn(ctx context.Context, authorShouldSave map[string]bool, days []time.Time, saveTo string, maxSaved int) error {
+	poolCount := options.GetInt("pages")
+	pool := rod.NewPagePool(poolCount)
+	defer pool.Cleanup(closePage)
 
-	// use tokyo time
-	// note: we do not really need this here for now
-	loc, err := time.LoadLocation("Asia/Tokyo")
-	if err != nil {
-		panic(err)
+	var count atomic.Uint64
+	var failed sync.Map
+
+	// each day is visited by the first page that is free
+	work := make(chan time.Time)
+	var wg sync.WaitGroup
+	for i := 0; i < poolCount && i < len(days); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			page, pageErr := getPage(pool)
+			defer func() { pool.Put(page) }()
+
+			for on := range work {
+				if pageErr == nil {
+					page, pageErr = renew(page)
+				}
+				if pageErr != nil {
+					// without a page we can only say why each day failed
+					failed.Store(on.Format("2006-01-02"), pageErr)
+					continue
+				}
+				err := saveDay(ctx, page, on, authorShouldSave, saveTo, uint64(maxSaved), &count)
+				if err != nil {
+					log.Printf("blog.SaveBlogsOn: %s", err)
+					failed.Store(on.Format("2006-01-02"), err)
+				}
+			}
+		}()
 	}
 
-	poolCount := 8
-	pool := rod.NewPagePool(poolCount)
-	createFn := func() *rod.Page {
-		return browser.MustPage().MustSetUserAgent(&proto.NetworkSetUserAgentOverride{
-			UserAgent: options.Get("user_agent"),
-		})
+	for _, on := range days {
+		if ctx.Err() != nil || count.Load() >= uint64(maxSaved) {
+			break
+		}
+		work <- on
 	}
+	close(work)
+	wg.Wait()
 
-	// get list of blogs
-	fmt.Println("[visit]", listPage)
+	failed.Range(func(k, v interface{}) bool {
+		fmt.Println("[failed]", k.(string), v.(error))
+		return true
+	})
+	fmt.Println("[saved]", count.Load(), "blogs")
 
-	page := pool.Get(createFn)
-	page.Timeout(WaitForSpiderTimeout).MustNavigate(listPage).MustWaitLoad()
+	return nil
+}
 
-	count := 0
+// saveDay saves blogs on the list for one day following the pager to the end of the day
+func saveDay(ctx context.Context, page *rod.Page, on time.Time, authorShouldSave map[string]bool, saveTo string, maxSaved uint64, count *atomic.Uint64) error {
+	dy := fmt.Sprintf("%04d%02d%02d", on.Year(), on.Month(), on.Day())
+	first := fmt.Sprintf(DayListURL, dy)
 
-	blogs, err := getBlogsFromPage(page)
-	if err != nil {
-		return fmt.Errorf("blog.SaveBlogsOn: %s", err)
-	}
+	visit := []string{first}
+	seen := map[string]bool{first: true}
+	// the pager may take us back to the first page so we only save a blog once
+	saved := make(map[string]bool)
+	for len(visit) > 0 {
+		link := visit[0]
+		visit = visit[1:]
 
-	for _, b := range blogs.Blogs {
-		if count > maxSaved {
-			log.Print("blog.SaveBlogsOn: reached max blog save count")
-			break
+		if ctx.Err() != nil {
+			return nil
 		}
 
-		at := time.Date(b.Year, b.Month, b.Day, 0, 0, 0, 0, loc)
-		// if there is space between this member's name remove it
-		author := strings.ReplaceAll(b.Name, " ", "")
-		if _, ok := authorShouldSave[author]; !ok {
-			continue
+		fmt.Println("[visit]", link)
+		if err := navigate(page, link, options.GetDuration("blog_list_timeout")); err != nil {
+			return err
 		}
-		link := b.Link
-		title := b.Title
 
-		count++
-		if count >= maxSaved {
-			log.Print("blog.SaveBlogsOn: reached max blog save count")
-			return nil
+		blogs, err := getBlogsFromPage(page)
+		if err != nil {
+			return err
 		}
 
-		err = saveBlogFromPage(ctx, page, link, title, author, at, saveTo)
-		if err != nil {
-			log.Printf("blog.SaveBlogsOn: %s", err)
+		// the list is newest first so once we see an older blog the day is over
+		older := false
+		for _, b := range blogs.Blogs {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			at := time.Date(b.Year, b.Month, b.Day, 0, 0, 0, 0, dates.Tokyo)
+			if at.Before(on) {
+				older = true
+				continue
+			}
+			if !at.Equal(on) {
+				continue
+			}
+			// the site may write a member's name with a space or variant kanji
+			author := members.RealName(b.Name)
+			if _, ok := authorShouldSave[author]; !ok || saved[b.Link] {
+				continue
+			}
+			saved[b.Link] = true
+
+			if count.Add(1) > maxSaved {
+				log.Print("blog.SaveBlogsOn: reached max blog save count")
+				// take back the one we did not save
+				count.Add(^uint64(0))
+				return nil
+			}
+
+			err = saveBlogFromPage(ctx, page, b.Link, b.Title, author, at, saveTo)
+			if err != nil {
+				log.Printf("blog.SaveBlogsOn: %s", err)
+			}
+		}
+		if older {
+			break
 		}
-	}
 
-	fmt.Println("[saved]", count, "blogs")
+		for _, p := range blogs.Pages {
+			if !seen[p] {
+				seen[p] = true
+				visit = append(visit, p)
+			}
+		}
+	}
 
 	return nil
 }
@@ -251,12 +386,13 @@ func getBlogsFromPage(page *rod.Page) (blogsFromPage, error) {
 }
 
 // uses jsBlogImages to grab images from a blog
-func getImagesFromPage(page *rod.Page) (images []image, err error) {
+func getImagesFromPage(ctx context.Context, page *rod.Page) (images []image, err error) {
 	evaluated, err := page.Eval(jsBlogImages)
 	if err != nil {
 		return nil, err
 	}
 
+	var mu sync.Mutex
 	var wg sync.WaitGroup
 
 	links := strings.Split(evaluated.Value.String(), ",")
@@ -264,31 +400,18 @@ func getImagesFromPage(page *rod.Page) (images []image, err error) {
 		wg.Add(1)
 		go func(l string) {
 			defer wg.Done()
-			var req *http.Request
-			req, err = http.NewRequest(http.MethodGet, l, nil)
-			if err != nil {
-				return
-			}
-			req.Header.Set("User-Agent", UserAgent)
-
-			var res *http.Response
-			res, err = httpClient.Do(req)
-			if err != nil {
-				return
-			}
+			data, e := getImage(ctx, l)
 
-			var data []byte
-			limited := io.LimitReader(res.Body, 100000000)
-			data, err = io.ReadAll(limited)
-			if err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			if e != nil {
+				err = e
 				return
 			}
 			images = append(images, image{
 				Link: l,
 				Data: data,
 			})
-
-			_ = res.Body.Close()
 		}(link)
 	}
 	wg.Wait()
@@ -296,6 +419,29 @@ func getImagesFromPage(page *rod.Page) (images []image, err error) {
 	return
 }
 
+// getImage from link
+func getImage(ctx context.Context, link string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", options.Get("user_agent"))
+
+	res, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// an error page is not an image
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", link, res.Status)
+	}
+
+	limited := io.LimitReader(res.Body, 100000000)
+	return io.ReadAll(limited)
+}
+
 func saveBlogFromPage(ctx context.Context, page *rod.Page, link string, title string, name string, at time.Time, saveTo string) error {
 	h := sha1.New()
 	h.Write([]byte(link))
@@ -307,6 +453,9 @@ func saveBlogFromPage(ctx context.Context, page *rod.Page, link string, title st
 	fmt.Println("[save]", link)
 	fmt.Println("[title]", title)
 
+	// count what we download for this member
+	ctx = fetch.WithLabel(ctx, name)
+
 	if v := ctx.Value(ShouldDryRun{}); v != nil {
 		fmt.Printf("[dry-run] %s\n", saveBlogAs)
 		return nil
@@ -319,12 +468,18 @@ func saveBlogFromPage(ctx context.Context, page *rod.Page, link string, title st
 	}
 
 	// visit the blog and take a screenshot
-	err = page.Navigate(link)
+	err = navigate(page, link, options.GetDuration("blog_timeout"))
 	if err != nil {
 		return err
 	}
 
-	page.MustWaitLoad()
+	if options.GetBool("strip_snapshot") {
+		// leave just the article in the archive
+		_, err = page.Eval(jsStripPage)
+		if err != nil {
+			return fmt.Errorf("while stripping page: %w", err)
+		}
+	}
 
 	snapshot, err := proto.PageCaptureSnapshot{}.Call(page)
 	if err != nil {
@@ -336,7 +491,7 @@ func saveBlogFromPage(ctx context.Context, page *rod.Page, link string, title st
 	}
 
 	// scrape images from an individual blog
-	blogImages, err := getImagesFromPage(page)
+	blogImages, err := getImagesFromPage(ctx, page)
 	if err != nil {
 		return err
 	}
@@ -353,5 +508,14 @@ func saveBlogFromPage(ctx context.Context, page *rod.Page, link string, title st
 		fmt.Println("[save] [image]", saveTo)
 	}
 
-	return nil
+	ix, err := OpenIndex(saveTo, name)
+	if err != nil {
+		return err
+	}
+	return ix.Add(link, Post{
+		Title:   title,
+		Posted:  at,
+		Path:    saveBlogAs,
+		SavedAt: time.Now(),
+	})
 }
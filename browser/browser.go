@@ -0,0 +1,226 @@
+// Package browser keeps one chrome for everything we do with a browser
+//
+// We either launch chrome ourselves or attach to one that is already running
+// such as chrome in a container when devtools_url is set.
+// If chrome crashes or goes away we start it again or attach to it again.
+package browser
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/fetch"
+	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+const (
+	// how often we make sure chrome is still there
+	checkEvery = 5 * time.Second
+	// how long chrome has to answer
+	checkTimeout = 10 * time.Second
+	// times we try to start chrome again before we give up
+	maxRestarts = 3
+)
+
+// Verbose logs what we ask chrome to do
+var Verbose bool
+
+var current = struct {
+	sync.Mutex
+	b        *rod.Browser
+	l        *launcher.Launcher
+	checked  time.Time
+	restarts int
+}{}
+
+// Get chrome starting it if we need to
+// chrome that stopped answering is started again
+func Get() (*rod.Browser, error) {
+	current.Lock()
+	defer current.Unlock()
+
+	if current.b != nil {
+		if time.Since(current.checked) < checkEvery {
+			return current.b, nil
+		}
+		if healthy(current.b) {
+			current.checked = time.Now()
+			return current.b, nil
+		}
+
+		if current.restarts >= maxRestarts {
+			return nil, fmt.Errorf("browser.Get: chrome stopped answering %d times so we gave up", current.restarts)
+		}
+		current.restarts++
+		log.Print("browser: chrome stopped answering so we start it again")
+		fmt.Println("[nok] chrome stopped answering so we start it again")
+		stop()
+	}
+
+	b, l, err := start()
+	if err != nil {
+		return nil, err
+	}
+	current.b = b
+	current.l = l
+	current.checked = time.Now()
+
+	return b, nil
+}
+
+// MustGet chrome or panic
+func MustGet() *rod.Browser {
+	b, err := Get()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Page with our user agent and headers that keeps to our download limit
+func Page() (*rod.Page, error) {
+	b, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := b.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("browser.Page: %s", err)
+	}
+	err = page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+		UserAgent: options.Get("user_agent"),
+	})
+	if err != nil {
+		_ = page.Close()
+		return nil, fmt.Errorf("browser.Page: %s", err)
+	}
+
+	// chrome sends our headers with what it downloads on its own
+	if headers := fetch.Headers(); len(headers) > 0 {
+		var dict []string
+		for k, v := range headers {
+			dict = append(dict, k, v)
+		}
+		if _, err := page.SetExtraHeaders(dict); err != nil {
+			log.Printf("browser.Page: headers: %s", err)
+		}
+	}
+
+	if rate := fetch.GlobalRate(); rate > 0 {
+		// chrome downloads what the page needs on its own so we ask it to keep to our limit too
+		_ = proto.NetworkEnable{}.Call(page)
+		err := proto.NetworkEmulateNetworkConditions{
+			DownloadThroughput: float64(rate),
+			UploadThroughput:   -1,
+		}.Call(page)
+		if err != nil {
+			log.Printf("browser.Page: limit rate: %s", err)
+		}
+	}
+
+	return page, nil
+}
+
+// Is true if b is the chrome we have now
+// pages from chrome before it was started again are no good
+func Is(b *rod.Browser) bool {
+	current.Lock()
+	defer current.Unlock()
+
+	return current.b == b
+}
+
+// Close chrome if we launched it or leave it running if we attached to it
+func Close() {
+	current.Lock()
+	defer current.Unlock()
+
+	stop()
+}
+
+// stop chrome and forget it
+// we must hold the lock
+func stop() {
+	if current.b == nil {
+		return
+	}
+
+	if current.l != nil {
+		if err := current.b.Close(); err != nil {
+			log.Printf("browser.Close: %s", err)
+		}
+		current.l.Kill()
+		current.l.Cleanup()
+	}
+
+	current.b = nil
+	current.l = nil
+}
+
+func healthy(b *rod.Browser) bool {
+	_, err := proto.BrowserGetVersion{}.Call(b.Timeout(checkTimeout))
+	if err != nil {
+		log.Printf("browser: check: %s", err)
+	}
+	return err == nil
+}
+
+// start chrome or attach to it
+func start() (*rod.Browser, *launcher.Launcher, error) {
+	if u := options.Get("devtools_url"); u != "" {
+		log.Printf("browser: attaching to %s", u)
+		ws, err := launcher.ResolveURL(u)
+		if err != nil {
+			return nil, nil, fmt.Errorf("browser.start: %s: %s", u, err)
+		}
+		b := rod.New().ControlURL(ws).Trace(Verbose)
+		if err := b.Connect(); err != nil {
+			return nil, nil, fmt.Errorf("browser.start: %s: %s", u, err)
+		}
+		return b, nil, nil
+	}
+
+	log.Print("browser: opening chrome...")
+	l := Launcher()
+	ws, err := l.Launch()
+	if err != nil {
+		l.Kill()
+		l.Cleanup()
+		return nil, nil, fmt.Errorf("browser.start: %s", err)
+	}
+	b := rod.New().ControlURL(ws).Trace(Verbose)
+	if err := b.Connect(); err != nil {
+		l.Kill()
+		l.Cleanup()
+		return nil, nil, fmt.Errorf("browser.start: %s", err)
+	}
+
+	return b, l, nil
+}
+
+// Launcher for chrome from the options
+// chrome uses our proxy and trusts our certificates
+func Launcher() *launcher.Launcher {
+	l := launcher.New().
+		Headless(options.GetBool("chrome_headless")).
+		Set(flags.RemoteDebuggingPort, strconv.Itoa(options.GetInt("chrome_port")))
+	if bin := options.Get("chrome_bin"); bin != "" {
+		l = l.Bin(bin)
+	}
+	if dir := options.Get("chrome_profile"); dir != "" {
+		// chrome keeps what it needs there so we leave it behind
+		l = l.UserDataDir(dir).Set(flags.KeepUserDataDir)
+	}
+	for name, value := range fetch.ChromeFlags() {
+		l = l.Set(flags.Flag(name), value)
+	}
+	return l
+}
@@ -4,45 +4,125 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/bobbytrapz/gochrome"
 	"github.com/bobbytrapz/hinatazaka/blog"
+	"github.com/bobbytrapz/hinatazaka/browser"
+	"github.com/bobbytrapz/hinatazaka/dates"
+	"github.com/bobbytrapz/hinatazaka/fetch"
 	"github.com/bobbytrapz/hinatazaka/members"
 	"github.com/bobbytrapz/hinatazaka/options"
 	"github.com/spf13/cobra"
 )
 
 var saveBlogsSince string
-var saveBlogsOn string
+var saveBlogsUntil string
+var saveBlogsOn []string
+var crawlStrategy string
 var saveTo string
 var maxSaved int
-var since time.Time
+var within dates.Range
+var sinceLast bool
+var onDays []time.Time
 var shouldPrintPath bool
 var shouldDryRun bool
+var shouldResume bool
+var shouldForce bool
+var shouldIncludeGraduated bool
+var checkpoint *blog.Checkpoint
 
 func init() {
 	rootCmd.AddCommand(blogCmd)
-	blogCmd.Flags().StringVar(&saveBlogsSince, "since", "", "Save any blogs newer than this date ex: 2019-03-27")
-	blogCmd.Flags().StringVar(&saveBlogsOn, "on", "", "Save any blogs posted on this date ex: 2019-03-27")
+	blogCmd.Flags().StringVar(&saveBlogsSince, "since", "", "Save any blogs newer than this date ex: 2019-03-27, 2020-01..2020-03, '3 weeks ago' or 先月")
+	blogCmd.Flags().StringVar(&saveBlogsUntil, "until", "", "Save any blogs older than the end of this date ex: 2019-03-27")
+	blogCmd.Flags().StringSliceVar(&saveBlogsOn, "on", nil, "Save any blogs posted on these dates ex: 2019-03-27, 2019-03 or 2019-03-01..2019-03-05")
+	blogCmd.Flags().StringVar(&crawlStrategy, "strategy", strategyMember, "How we find blogs: 'member' visits each member's list and 'day' visits the list for each day")
 	blogCmd.Flags().IntVar(&maxSaved, "count", math.MaxInt32, "The max number of blogs to save.")
 	blogCmd.Flags().StringVar(&saveTo, "saveto", "", "Directory path to save blog data to")
 	blogCmd.Flags().BoolVar(&shouldPrintPath, "path", false, "Print the path where we will save blog data")
 	blogCmd.Flags().BoolVar(&shouldDryRun, "dry-run", false, "Show where we would save a blog but do not save it")
+	blogCmd.Flags().BoolVar(&shouldResume, "resume", false, "Continue the crawl that was stopped")
+	blogCmd.Flags().BoolVar(&shouldForce, "force", false, "Start a new crawl even if one that saves to the same place was stopped")
+	blogCmd.Flags().Int("pages", 0, "Pages we open in chrome at once instead of the pages option")
+	blogCmd.Flags().Duration("list-timeout", 0, "Time we wait for a list of blogs instead of the blog_list_timeout option ex: 2m")
+	blogCmd.Flags().Duration("blog-timeout", 0, "Time we wait for a blog instead of the blog_timeout option ex: 2m")
+	blogCmd.Flags().Duration("spider-timeout", 0, "Time we wait to find another list of blogs instead of the spider_timeout option ex: 2m")
+	blogCmd.Flags().BoolVar(&shouldIncludeGraduated, "include-graduated", false, "Include graduated members when using 'all' or a generation")
+	blogCmd.RegisterFlagCompletionFunc("since", completeKeywords(sinceKeywords))
+	blogCmd.RegisterFlagCompletionFunc("until", completeKeywords(onKeywords))
+	blogCmd.RegisterFlagCompletionFunc("on", completeKeywords(onKeywords))
+	blogCmd.RegisterFlagCompletionFunc("strategy", completeKeywords(strategies))
+	blogCmd.MarkFlagDirname("saveto")
+}
+
+const (
+	// visit each member's list of blogs
+	strategyMember = "member"
+	// visit the list of every member's blogs for each day
+	strategyDay = "day"
+)
+
+var strategies = [][2]string{
+	{strategyMember, "visit each member's list of blogs"},
+	{strategyDay, "visit the list of blogs for each day which is quicker for many members over a few days"},
+}
+
+// keywords we understand as dates and what they mean
+var sinceKeywords = [][2]string{
+	{"today", "blogs posted today"},
+	{"yesterday", "blogs posted since yesterday"},
+	{"week", "blogs posted this week"},
+	{"month", "blogs posted this month"},
+	{"year", "blogs posted this year"},
+	{"forever", "every blog"},
+	{"last", "blogs posted since the newest one we saved"},
+}
+
+// keywords we understand as a day
+var onKeywords = [][2]string{
+	{"today", "blogs posted today"},
+	{"yesterday", "blogs posted yesterday"},
+}
+
+// checkSaveTo is a directory we can save blogs to
+func checkSaveTo(saveTo string) error {
+	if stat, err := os.Stat(saveTo); os.IsNotExist(err) || !stat.IsDir() {
+		abs, _ := filepath.Abs(saveTo)
+		return errors.New("Save path must be a directory: " + abs)
+	}
+	return nil
 }
 
 var blogCmd = &cobra.Command{
-	Use:   "blog [members]",
-	Short: "Save a blog as a pdf along with save each image",
-	Args: func(cmd *cobra.Command, args []string) (err error) {
+	Use:               "blog [members]",
+	Short:             "Save a blog as a pdf along with save each image",
+	ValidArgsFunction: completeMembers,
+	// options and members are loaded by the time we check what we were given
+	PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+		if shouldResume {
+			if len(args) > 0 || saveBlogsSince != "" || saveBlogsUntil != "" || len(saveBlogsOn) > 0 || shouldPrintPath {
+				return errors.New("You cannot use 'resume' with members, dates or 'path'")
+			}
+			// each place we save to has its own crawl to resume
+			if saveTo == "" {
+				saveTo = options.Get("save_to")
+			}
+			checkpoint, err = blog.LoadCheckpoint(blog.CheckpointPath(options.ConfigPath, saveTo))
+			if err != nil {
+				return err
+			}
+			within = dates.Range{From: checkpoint.Since, Until: checkpoint.Until}
+			sinceLast = checkpoint.SinceLast
+			saveTo = checkpoint.SaveTo
+			maxSaved = checkpoint.MaxSaved
+			return checkSaveTo(saveTo)
+		}
+
 		if len(args) < 1 {
 			return errors.New("We need at least one name/nickname of a hinatazaka member")
 		}
@@ -51,124 +131,159 @@ var blogCmd = &cobra.Command{
 			saveTo = options.Get("save_to")
 		}
 
-		if stat, err := os.Stat(saveTo); os.IsNotExist(err) || !stat.IsDir() {
-			abs, _ := filepath.Abs(saveTo)
-			return errors.New("Save path must be a directory: " + abs)
+		if err := checkSaveTo(saveTo); err != nil {
+			return err
 		}
 
-		if saveBlogsSince != "" && saveBlogsOn != "" {
+		if saveBlogsSince != "" && len(saveBlogsOn) > 0 {
 			return errors.New("You cannot use both 'on' and 'since'")
 		}
 
+		if crawlStrategy != strategyMember && crawlStrategy != strategyDay {
+			return fmt.Errorf("We do not know the strategy %q", crawlStrategy)
+		}
+
 		if shouldPrintPath && saveBlogsSince != "" {
 			return errors.New("You cannot use both 'path' and 'since'")
 		}
 
-		// use tokyo time
-		loc, err := time.LoadLocation("Asia/Tokyo")
-		if err != nil {
-			panic(err)
-		}
-
-		y, m, d := time.Now().In(loc).Date()
-		today := time.Date(y, m, d, 0, 0, 0, 0, loc)
-
-		if saveBlogsOn != "" {
-			saveBlogsSince = saveBlogsOn
-		}
-
-		switch saveBlogsSince {
-		case "":
-			fallthrough
-		case "today":
-			// same as default
-			since = today
-		case "forever":
-			// save all blogs since forever
-			since = time.Time{}
-		case "yesterday":
-			since = today.AddDate(0, 0, -1)
-		case "week":
-			// within this week
-			weekday := today.Weekday()
-			since = today.AddDate(0, 0, -int(weekday))
-		case "month":
-			// within this month
-			day := today.Day()
-			since = today.AddDate(0, 0, -int(day)+1)
-		case "year":
-			// within this year
-			month := today.Month()
-			day := today.Day()
-			since = today.AddDate(0, -int(month)+1, -int(day)+1)
-		default:
-			var t time.Time
-			var err error
-			if strings.ContainsAny(saveBlogsSince, "-") {
-				t, err = time.Parse("2006-01-02", saveBlogsSince)
+		now := time.Now()
+		if len(saveBlogsOn) > 0 {
+			// every blog posted on a day, month or range of days
+			var ranges []dates.Range
+			for _, on := range saveBlogsOn {
+				r, err := dates.Parse(on, now)
 				if err != nil {
-					// the dates on a blog do not have a leading zero so we try this too
-					t, err = time.Parse("2006-1-2", saveBlogsSince)
+					return err
 				}
-			} else {
-				t, err = time.Parse("2006.01.02", saveBlogsSince)
-				if err != nil {
-					t, err = time.Parse("2006.1.2", saveBlogsSince)
+				if r.From.IsZero() {
+					return errors.New("We need a day to start from with 'on'")
 				}
+				ranges = append(ranges, r)
 			}
-			if err == nil {
-				// parsed a date
-				y, m, d := t.In(loc).Date()
-				since = time.Date(y, m, d, 0, 0, 0, 0, loc)
-			} else {
-				// not a date; check for a number of days ago
-				numDays, e := strconv.ParseInt(saveBlogsSince, 10, 64)
-				if e != nil {
-					return err
-				}
-				if numDays < 0 {
-					return errors.New("Number of days must be positive")
+			onDays = dates.Days(now, ranges...)
+			if len(onDays) == 0 {
+				return errors.New("We need a day that is not in the future with 'on'")
+			}
+			within = dates.Range{From: onDays[0], Until: onDays[len(onDays)-1].AddDate(0, 0, 1)}
+		} else if saveBlogsSince == "last" {
+			// each member starts from the newest blog we saved for them
+			sinceLast = true
+			within = dates.Range{}
+		} else if within, err = dates.Since(saveBlogsSince, now); err != nil {
+			return err
+		}
+		if saveBlogsUntil != "" {
+			if within.Until, err = dates.Until(saveBlogsUntil, now); err != nil {
+				return err
+			}
+			if !within.Until.IsZero() && !within.From.Before(within.Until) {
+				return errors.New("We need 'until' to be after 'since'")
+			}
+			// keep the days we were given that are before until
+			var days []time.Time
+			for _, d := range onDays {
+				if within.Contains(d) {
+					days = append(days, d)
 				}
-				y, m, d := today.AddDate(0, 0, int(-numDays)).Date()
-				since = time.Date(y, m, d, 0, 0, 0, 0, loc)
 			}
+			if len(saveBlogsOn) > 0 && len(days) == 0 {
+				return errors.New("We need 'until' to be after 'on'")
+			}
+			onDays = days
+		}
+
+		if crawlStrategy == strategyDay && len(onDays) == 0 {
+			if sinceLast || within.From.IsZero() {
+				return errors.New("We need a day to start from with the 'day' strategy")
+			}
+			onDays = dates.Days(now, within)
 		}
 
 		if shouldPrintPath {
 			if len(args) > 1 {
 				return errors.New("We can only print one member save path at a time")
 			}
-			if members.RealName(args[0]) == "" {
-				return errors.New("You must provide a valid member name")
+			if _, ok := members.Find(args[0]); !ok {
+				return unknownMember(args[0])
 			}
 		}
 
+		// a new crawl would replace the checkpoint of one that was stopped
+		usesCheckpoint := !shouldPrintPath && !shouldDryRun && len(onDays) == 0
+		if usesCheckpoint && !shouldForce && blog.HasCheckpoint(options.ConfigPath, saveTo) {
+			return errors.New("A crawl that saves to the same place was stopped. Use 'hinatazaka blog --resume' to continue it or --force to start over")
+		}
+
 		return
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if shouldPrintPath {
-			name := members.RealName(args[0])
-			at := since.Format("2006-01-02")
-			path := filepath.Join(options.Get("save_to"), name, at)
+			m, _ := members.Find(args[0])
+			at := within.From.Format("2006-01-02")
+			path := filepath.Join(options.Get("save_to"), m.Name, at)
 			fmt.Printf("%s", path)
 			return
 		}
 
 		// unique args
 		uniqueArgs := map[string]bool{}
+		if checkpoint != nil {
+			for _, c := range checkpoint.Crawls {
+				uniqueArgs[c.Member] = true
+			}
+		}
+		// graduated members we are not saving with 'all' or a generation
+		var skipped []members.Member
+		addActive := func(ms []members.Member) {
+			for _, m := range ms {
+				if m.IsGraduated() && !shouldIncludeGraduated {
+					skipped = append(skipped, m)
+					continue
+				}
+				if m.IsGraduated() {
+					if ix := archiveIndex(m); ix != nil && ix.IsFrozen() {
+						fmt.Printf("[frozen] %s\n", m)
+						continue
+					}
+				}
+				uniqueArgs[m.Name] = true
+			}
+		}
 		for _, a := range args {
 			if a == "all" {
-				for m := range members.Blogs {
-					uniqueArgs[m] = true
-				}
+				addActive(members.All())
 				break
 			}
-			addArg := members.RealName(a)
-			if _, ok := members.Blogs[addArg]; !ok {
-				fmt.Printf("We do not know who %q is.\n", a)
+			if m, ok := members.Find(a); ok {
+				uniqueArgs[m.Name] = true
+				continue
+			}
+			g, ok := members.FindGroup(a)
+			if !ok {
+				fmt.Println(unknownMember(a))
 				return
 			}
-			uniqueArgs[addArg] = true
+			if g.Generation != 0 {
+				addActive(g.Members)
+				continue
+			}
+			for _, m := range g.Members {
+				uniqueArgs[m.Name] = true
+			}
+		}
+
+		// graduated members will not post again so we want all of their blogs
+		var graduated []members.Member
+		for name := range uniqueArgs {
+			if m, ok := members.Find(name); ok && m.IsGraduated() {
+				graduated = append(graduated, m)
+			}
+		}
+		for _, m := range append(graduated, skipped...) {
+			if ix := archiveIndex(m); ix != nil && !ix.IsComplete() {
+				fmt.Printf("[warn] %s graduated but the archive is incomplete. Use 'hinatazaka blog %s --since forever' to finish it.\n", m, m.Name)
+			}
 		}
 
 		ctx := context.Background()
@@ -177,32 +292,34 @@ var blogCmd = &cobra.Command{
 
 		if shouldDryRun {
 			ctx = context.WithValue(ctx, blog.ShouldDryRun{}, struct{}{})
+		} else if len(onDays) == 0 {
+			if checkpoint == nil {
+				checkpoint = blog.NewCheckpoint(blog.CheckpointPath(options.ConfigPath, saveTo), within, saveTo, maxSaved)
+				checkpoint.SinceLast = sinceLast
+			}
+			ctx = context.WithValue(ctx, blog.UseCheckpoint{}, checkpoint)
 		}
-
-		if verbose {
-			gochrome.Log = log.Printf
+		if sinceLast {
+			// we start from the day of the newest blog so skip what we have from that day
+			ctx = context.WithValue(ctx, blog.SkipSaved{}, struct{}{})
 		}
 
-		browser := gochrome.NewBrowser()
-		browser.UserAgent = options.Get("user_agent")
+		// chrome is started when we open the first page
+		defer browser.Close()
 
-		_, err := browser.Start(ctx, gochrome.TemporaryUserProfileDirectory, port)
-		if err != nil {
-			panic(err)
-		}
-		defer browser.Wait()
+		go fetch.ShowProgress(ctx, progressEvery)
 
 		var wg sync.WaitGroup
 
-		// if --on is used --since is ignored
-		if saveBlogsOn != "" {
-			fmt.Printf("Saving blogs posted on %s\n", since.Format("2006-01-02"))
+		// we visit the list for each day with --on or the day strategy
+		if len(onDays) > 0 {
+			fmt.Printf("Saving blogs posted on %d days %s\n", len(onDays), within)
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				err := blog.SaveBlogsOn(ctx, uniqueArgs, since, saveTo, maxSaved)
+				err := blog.SaveBlogsOn(ctx, uniqueArgs, onDays, saveTo, maxSaved)
 				if err != nil {
-					fmt.Printf("Error: %v", err)
+					fmt.Println("Error:", err)
 				}
 			}()
 		} else {
@@ -211,37 +328,104 @@ var blogCmd = &cobra.Command{
 				wg.Add(1)
 				go func(m string) {
 					defer wg.Done()
-					link := members.BlogURL(m)
+					member, _ := members.Find(m)
+					link := member.BlogURL()
 					if link == "" {
-						fmt.Printf("Missing blog url for %q.\n", m)
+						fmt.Printf("Missing blog url for %s.\n", member)
 						return
 					}
-					fmt.Printf("Saving %s blogs since %s\n", m, since.Format("2006-01-02"))
-					err := blog.SaveBlogsSince(ctx, link, since, saveTo, uint64(maxSaved))
+					if checkpoint != nil {
+						checkpoint.Begin(m, link)
+					}
+					r := within
+					if sinceLast {
+						r.From = lastPosted(member)
+					}
+					fmt.Printf("Saving %s blogs posted %s\n", member, r)
+					err := blog.SaveBlogsSince(ctx, link, r, saveTo, uint64(maxSaved))
 					if err != nil {
-						fmt.Printf("Error: %v", err)
+						fmt.Println("Error:", err)
 					}
 				}(member)
 			}
 		}
 
+		done := make(chan struct{})
 		go func() {
 			wg.Wait()
-			cancel()
+			close(done)
 		}()
 
 		// handle interrupt
+		// the first one stops the crawl and the second one quits
+		// blogs we did not finish are not in the checkpoint so they are saved when we resume
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, os.Interrupt)
 
 		for {
 			select {
 			case <-sig:
+				if ctx.Err() != nil {
+					fmt.Println("[quit]")
+					os.Exit(1)
+				}
+				fmt.Println("[stop] Stopping the blogs in progress. Interrupt again to quit now.")
+				cancel()
+			case <-done:
+				fetch.PrintSummary()
+				if !shouldDryRun {
+					freezeArchives(graduated)
+				}
+				if ctx.Err() != nil && checkpoint != nil {
+					fmt.Println("Use 'hinatazaka blog --resume' to continue.")
+				}
 				signal.Stop(sig)
 				cancel()
-			case <-ctx.Done():
 				return
 			}
 		}
 	},
 }
+
+// lastPosted is the day of the newest blog we saved for a member
+// we start from that day since a member may post more than once a day
+func lastPosted(m members.Member) time.Time {
+	ix := archiveIndex(m)
+	if ix == nil {
+		return time.Time{}
+	}
+	latest := ix.Latest()
+	if latest.IsZero() {
+		latest = blog.LatestOnDisk(saveTo, m.Name)
+	}
+	if latest.IsZero() {
+		fmt.Printf("[new] We have not saved anything for %s so we save every blog\n", m)
+		return latest
+	}
+	return dates.Day(latest)
+}
+
+// archiveIndex of a member or nil if we cannot read it
+func archiveIndex(m members.Member) *blog.Index {
+	ix, err := blog.OpenIndex(saveTo, m.Name)
+	if err != nil {
+		fmt.Println("[nok]", err)
+		return nil
+	}
+	return ix
+}
+
+// freezeArchives of graduated members once we have all of their blogs
+func freezeArchives(graduated []members.Member) {
+	for _, m := range graduated {
+		ix := archiveIndex(m)
+		if ix == nil || !ix.IsComplete() || ix.IsFrozen() {
+			continue
+		}
+		if err := ix.Freeze(); err != nil {
+			fmt.Println("[nok]", err)
+			continue
+		}
+		fmt.Printf("[frozen] %s\n", m)
+	}
+}
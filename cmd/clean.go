@@ -4,11 +4,15 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/bobbytrapz/hinatazaka/options"
 	"github.com/spf13/cobra"
 )
 
+var shouldCleanCache bool
+
 func init() {
 	rootCmd.AddCommand(cleanCmd)
+	cleanCmd.Flags().BoolVar(&shouldCleanCache, "cache", false, "Also delete the http cache")
 }
 
 var cleanCmd = &cobra.Command{
@@ -27,5 +31,12 @@ var cleanCmd = &cobra.Command{
 		if err := os.RemoveAll(d); err != nil {
 			panic(err)
 		}
+		if shouldCleanCache {
+			c := options.Get("cache_dir")
+			println("[delete]", c)
+			if err := os.RemoveAll(c); err != nil {
+				panic(err)
+			}
+		}
 	},
 }
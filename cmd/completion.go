@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bobbytrapz/hinatazaka/members"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Print a shell script that completes commands, members and dates",
+	Long: `Print a shell script that completes commands, members and dates.
+
+Bash:
+  source <(hinatazaka completion bash)
+
+Zsh:
+  hinatazaka completion zsh > "${fpath[1]}/_hinatazaka"
+
+Fish:
+  hinatazaka completion fish > ~/.config/fish/completions/hinatazaka.fish
+
+PowerShell:
+  hinatazaka completion powershell | Out-String | Invoke-Expression
+`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.ExactValidArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			err = rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			err = rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			err = rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+// completeMembers with their names, nicknames and groups
+func completeMembers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	given := make(map[string]bool)
+	for _, a := range args {
+		given[a] = true
+	}
+
+	var completions []string
+	add := func(name string, description string) {
+		if given[name] || !strings.HasPrefix(strings.ToLower(name), strings.ToLower(toComplete)) {
+			return
+		}
+		completions = append(completions, name+"\t"+description)
+	}
+
+	add("all", "every member")
+	for _, g := range members.Groups() {
+		add(g.Name, fmt.Sprintf("%d members", len(g.Members)))
+	}
+	for _, m := range members.All() {
+		add(m.Name, m.Romaji)
+		for _, n := range m.Nicknames {
+			add(n, m.Name)
+		}
+	}
+
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeMember for commands that take one member
+func completeMember(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, m := range members.All() {
+		for _, n := range append([]string{m.Name}, m.Nicknames...) {
+			if strings.HasPrefix(strings.ToLower(n), strings.ToLower(toComplete)) {
+				completions = append(completions, n+"\t"+m.Name)
+			}
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeKeywords from a list of keywords and what they mean
+func completeKeywords(keywords [][2]string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var completions []string
+		for _, k := range keywords {
+			if strings.HasPrefix(k[0], toComplete) {
+				completions = append(completions, k[0]+"\t"+k[1])
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
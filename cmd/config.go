@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show, change or check the options in " + options.Filename + "." + options.Format,
+	// we do not check the config first since this is how it is fixed
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := options.Load(configFile, profile); err != nil {
+			fmt.Fprintln(os.Stderr, "[nok]", err)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every option with its type, value and what it does",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, k := range options.Schema {
+			if k.Type == options.TypeTable {
+				fmt.Printf("[%s] (%s)\n", k.Name, k.Type)
+				fmt.Printf("    %s\n", k.Description)
+				continue
+			}
+			fmt.Printf("%s (%s) = %s\n", k.Name, k.Type, formatOption(options.Value(k.Name)))
+			fmt.Printf("    %s. Default: %s\n", k.Description, formatOption(options.Default(k.Name)))
+		}
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:               "get [option]",
+	SilenceUsage:      true,
+	Short:             "Print the value of an option",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeOptions,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, ok := options.Find(args[0])
+		if !ok {
+			return fmt.Errorf("We do not know the option %q", args[0])
+		}
+		if k.Type == options.TypeTable {
+			printJSON(options.Value(k.Name))
+			return nil
+		}
+		fmt.Println(formatOption(options.Value(k.Name)))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:               "set [option] [value]",
+	SilenceUsage:      true,
+	Short:             "Change an option and save it. Separate a list with commas.",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeOptions,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := options.Set(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("[ok] %s = %s\n", args[0], formatOption(options.Value(args[0])))
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:          "edit",
+	SilenceUsage: true,
+	Short:        "Open the config file in $EDITOR and check it when you are done",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+			if runtime.GOOS == "windows" {
+				editor = "notepad"
+			}
+		}
+
+		// the editor may have arguments like 'code --wait'
+		parts := strings.Fields(editor)
+		c := exec.Command(parts[0], append(parts[1:], options.ConfigFile())...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			return err
+		}
+
+		if err := options.Reload(); err != nil {
+			return err
+		}
+		return validateConfig()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:          "validate",
+	SilenceUsage: true,
+	Short:        "Check every option in the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return validateConfig()
+	},
+}
+
+// validateConfig prints each problem with the config
+func validateConfig() error {
+	problems := options.Validate()
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, "[nok]", p)
+	}
+	if len(problems) > 0 {
+		return errors.New("Please fix " + options.ConfigFile())
+	}
+	fmt.Println("[ok]", options.ConfigFile())
+	return nil
+}
+
+// formatOption for printing with lists separated by commas
+func formatOption(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		var list []string
+		for _, e := range v {
+			list = append(list, fmt.Sprint(e))
+		}
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// completeOptions with the names of options
+func completeOptions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, k := range options.Schema {
+		if strings.HasPrefix(k.Name, toComplete) {
+			completions = append(completions, k.Name+"\t"+k.Description)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bobbytrapz/hinatazaka/fetch"
+	"github.com/bobbytrapz/hinatazaka/members"
+	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/spf13/cobra"
+)
+
+var updateMembersFrom string
+var shouldDryRunUpdate bool
+var shouldMarkGraduated bool
+var shouldPrintJSON bool
+
+func init() {
+	rootCmd.AddCommand(membersCmd)
+	membersCmd.AddCommand(membersListCmd)
+	membersCmd.AddCommand(membersShowCmd)
+	membersCmd.AddCommand(membersUpdateCmd)
+	membersCmd.AddCommand(membersGroupsCmd)
+	membersCmd.PersistentFlags().BoolVar(&shouldPrintJSON, "json", false, "Print members as json")
+	membersUpdateCmd.Flags().StringVar(&updateMembersFrom, "from", "", "Read members from a saved copy of the member list page")
+	membersUpdateCmd.Flags().BoolVar(&shouldDryRunUpdate, "dry-run", false, "Show the members we find but do not save them")
+	membersUpdateCmd.Flags().BoolVar(&shouldMarkGraduated, "mark-graduated", false, "Mark members who are not on the site as graduated")
+}
+
+var membersCmd = &cobra.Command{
+	Use:   "members",
+	Short: "Show or update what we know about each member",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var membersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every member we know",
+	Run: func(cmd *cobra.Command, args []string) {
+		all := members.All()
+		if shouldPrintJSON {
+			printJSON(all)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tKANA\tROMAJI\tGEN\tBIRTHDAY\tCT\tSTATUS")
+		for _, m := range all {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%d\t%s\n", m.Name, m.Kana, m.Romaji, m.Generation, m.Birthday, m.CT, m.Status)
+		}
+		w.Flush()
+	},
+}
+
+var membersShowCmd = &cobra.Command{
+	Use:               "show [member]",
+	Short:             "Show what we know about a member",
+	ValidArgsFunction: completeMember,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("We need the name/nickname of one hinatazaka member")
+		}
+		if _, ok := members.Find(args[0]); !ok {
+			return unknownMember(args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		m, _ := members.Find(args[0])
+		if shouldPrintJSON {
+			printJSON(m)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "name\t%s\n", m.Name)
+		fmt.Fprintf(w, "kana\t%s\n", m.Kana)
+		fmt.Fprintf(w, "romaji\t%s\n", m.Romaji)
+		fmt.Fprintf(w, "generation\t%d\n", m.Generation)
+		fmt.Fprintf(w, "birthday\t%s\n", m.Birthday)
+		fmt.Fprintf(w, "ct\t%d\n", m.CT)
+		fmt.Fprintf(w, "status\t%s\n", m.Status)
+		if m.Graduated != "" {
+			fmt.Fprintf(w, "graduated\t%s\n", m.Graduated)
+		}
+		fmt.Fprintf(w, "blog\t%s\n", m.BlogURL())
+		fmt.Fprintf(w, "nicknames\t%s\n", strings.Join(m.Nicknames, ", "))
+		w.Flush()
+	},
+}
+
+var membersGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "List the groups of members we can save at once",
+	Run: func(cmd *cobra.Command, args []string) {
+		groups := members.Groups()
+		if shouldPrintJSON {
+			printJSON(groups)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tMEMBERS")
+		for _, g := range groups {
+			var names []string
+			for _, m := range g.Members {
+				names = append(names, m.Name)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", g.Name, strings.Join(names, ", "))
+		}
+		w.Flush()
+	},
+}
+
+var membersUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Find members on the official site and save them to " + members.RosterFilename,
+	Run: func(cmd *cobra.Command, args []string) {
+		var in io.Reader
+		if updateMembersFrom != "" {
+			f, err := os.Open(updateMembersFrom)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer f.Close()
+			fmt.Println("[read]", updateMembersFrom)
+			in = f
+		} else {
+			link := members.ArtistListURL
+			req, err := http.NewRequest(http.MethodGet, link, nil)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			req.Header.Set("User-Agent", options.Get("user_agent"))
+
+			fmt.Println("[visit]", link)
+			client := &http.Client{
+				Timeout:   options.GetDuration("http_timeout"),
+				Transport: fetch.NewTransport(nil),
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				fmt.Println("Error:", link, res.Status)
+				return
+			}
+			in = res.Body
+		}
+
+		found, err := members.Discover(in)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(found) == 0 {
+			fmt.Println("We did not find any members. The page may have changed.")
+			return
+		}
+
+		for i, e := range found {
+			m, ok := members.Find(e.Name)
+			switch {
+			case !ok:
+				fmt.Println("[new]", e.Name, e.CT)
+			case m.IsGraduated():
+				// a member on the site has not graduated after all
+				fmt.Println("[active]", m.Name, e.CT)
+				found[i].Status = members.StatusActive
+			default:
+				fmt.Println("[found]", m.Name, e.CT)
+			}
+		}
+
+		// members who are not on the site may have graduated
+		// or the page may be missing some of them so we only mark them when asked
+		onSite := make(map[int]bool)
+		for _, e := range found {
+			onSite[e.CT] = true
+		}
+		var left []members.Member
+		active := 0
+		for _, m := range members.All() {
+			if m.IsGraduated() {
+				continue
+			}
+			active++
+			if onSite[m.CT] {
+				continue
+			}
+			fmt.Println("[missing]", m)
+			left = append(left, members.Member{
+				Name:   m.Name,
+				Status: members.StatusGraduated,
+			})
+		}
+		if len(left) > 0 && !shouldMarkGraduated {
+			fmt.Println("We did not find some members on the site. Use --mark-graduated if they have graduated.")
+			left = nil
+		}
+		if len(left) > 0 && 2*len(left) > active {
+			fmt.Println("We did not find most of the members on the site so we will not mark them as graduated. The page may have changed.")
+			left = nil
+		}
+
+		if shouldDryRunUpdate {
+			return
+		}
+
+		path := members.RosterPath()
+		roster, err := members.ReadRoster(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("Error:", err)
+			return
+		}
+		roster = members.MergeRoster(roster, found)
+		roster = members.MergeRoster(roster, left)
+
+		if err := members.WriteRoster(path, roster); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("[ok] wrote %d members to %s\n", len(roster), path)
+	},
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// unknownMember says we do not know who name is and suggests who it might be
+func unknownMember(name string) error {
+	if matches := members.Suggest(name, 1); len(matches) > 0 {
+		m := matches[0]
+		if members.Canonical(m.Key) == members.Canonical(m.Member.Name) {
+			return fmt.Errorf("We do not know who %q is. Did you mean %s?", name, m.Member.Name)
+		}
+		return fmt.Errorf("We do not know who %q is. Did you mean %s (%s)?", name, m.Member.Name, m.Key)
+	}
+	return fmt.Errorf("We do not know who %q is", name)
+}
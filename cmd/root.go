@@ -1,18 +1,68 @@
 package cmd
 
 import (
-	"os"	
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/bobbytrapz/hinatazaka/browser"
+	"github.com/bobbytrapz/hinatazaka/fetch"
+	"github.com/bobbytrapz/hinatazaka/members"
 	"github.com/bobbytrapz/hinatazaka/options"
 	"github.com/spf13/cobra"
 )
 
+// how often we show how much we downloaded
+const progressEvery = 10 * time.Second
+
 var verbose bool
+var limitRates []string
 var userProfileDir = "~/.config/hinatazaka/hinatazaka-profile"
-var port = options.GetInt("chrome_port")
+var configFile string
+var profile string
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show verbose output")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", os.Getenv(options.EnvPrefix+"_CONFIG"), "Use this config file instead of "+options.Filename+"."+options.Format+" in the config directory")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", os.Getenv(options.EnvPrefix+"_PROFILE"), "Use the options in this profile of the config file ex: nas")
+	rootCmd.PersistentFlags().BoolVar(&fetch.Offline, "offline", false, "Replay what we fetched before instead of using the network")
+	rootCmd.PersistentFlags().StringSliceVar(&limitRates, "limit-rate", nil, "Limit download speed ex: 500k or cdn.hinatazaka46.com=200k")
+	rootCmd.PersistentFlags().String("user-agent", "", "User agent we send instead of the user_agent option")
+	rootCmd.PersistentFlags().Duration("http-timeout", 0, "Time we wait for each download instead of the http_timeout option ex: 90s")
+}
+
+// flags that replace an option until we exit
+var optionFlags = []struct {
+	flag   string
+	option string
+}{
+	{"user-agent", "user_agent"},
+	{"http-timeout", "http_timeout"},
+	{"pages", "pages"},
+	{"list-timeout", "blog_list_timeout"},
+	{"blog-timeout", "blog_timeout"},
+	{"spider-timeout", "spider_timeout"},
+	{"tabs", "tabs"},
+	{"page-timeout", "page_timeout"},
+	{"gallery-pages", "gallery_pages"},
+	{"jobs", "jobs"},
+}
+
+// overrideOptions with the flags we were given
+func overrideOptions(cmd *cobra.Command) (problems []error) {
+	for _, o := range optionFlags {
+		f := cmd.Flags().Lookup(o.flag)
+		if f == nil || !f.Changed {
+			continue
+		}
+		if err := options.Override(o.option, f.Value.String()); err != nil {
+			// the error names the option but it is clearer to name the flag
+			problems = append(problems, fmt.Errorf("--%s: %s", o.flag, strings.TrimPrefix(err.Error(), o.option+": ")))
+		}
+	}
+	return
 }
 
 var rootCmd = &cobra.Command{
@@ -22,7 +72,39 @@ var rootCmd = &cobra.Command{
 Bobby wrote this.
 https://github.com/bobbytrapz/hinatazaka#readme
 `,
-	Run: func(cmd *cobra.Command, args []string) {	
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// the shell reads completions from stdout so we only load what we can
+		// and leave problems for when the command is run
+		if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+			options.Load(configFile, profile)
+			members.Load()
+			return nil
+		}
+
+		// problems loading are shown with the other problems
+		options.Load(configFile, profile)
+		flagProblems := overrideOptions(cmd)
+		problems := options.Validate()
+		for _, p := range append(flagProblems, problems...) {
+			fmt.Fprintln(os.Stderr, "[nok]", p)
+		}
+		if len(problems) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("Please fix %s or use 'hinatazaka config edit'", options.ConfigFile())
+		}
+		if len(flagProblems) > 0 {
+			return errors.New("We cannot use those flags")
+		}
+		if err := members.Load(); err != nil {
+			return err
+		}
+		browser.Verbose = verbose
+		if err := fetch.Configure(); err != nil {
+			return err
+		}
+		return fetch.LimitRates(limitRates)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Usage()
 	},
 }
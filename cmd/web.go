@@ -1,35 +1,92 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"github.com/bobbytrapz/gochrome"
-	"log"
+	"io"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 
+	"github.com/bobbytrapz/hinatazaka/browser"
+	"github.com/bobbytrapz/hinatazaka/fetch"
 	"github.com/bobbytrapz/hinatazaka/options"
 	"github.com/bobbytrapz/hinatazaka/scrape"
 	"github.com/spf13/cobra"
 )
 
 var saveWebImagesTo string
+var webInput string
+var shouldScrapeAgain bool
 
 func init() {
 	rootCmd.AddCommand(webCmd)
 	webCmd.Flags().StringVar(&saveWebImagesTo, "saveto", "./", "Save images to the given path")
+	webCmd.MarkFlagDirname("saveto")
+	webCmd.Flags().StringVar(&webInput, "input", "", "File with a link on each line or - for stdin")
+	webCmd.MarkFlagFilename("input")
+	webCmd.Flags().Int("jobs", 0, "Links we save images from at once instead of the jobs option")
+	webCmd.Flags().BoolVar(&shouldScrapeAgain, "again", false, "Save images from links we saved before")
+	webCmd.Flags().Int("tabs", 0, "Tabs we open in chrome at once instead of the tabs option")
+	webCmd.Flags().Duration("page-timeout", 0, "Time we wait for a page to load instead of the page_timeout option ex: 30s")
+	webCmd.Flags().Int("gallery-pages", 0, "Pages of a gallery we follow instead of the gallery_pages option")
+}
+
+// comment after a link such as https://ray-web.jp/123 # kyoko
+var webComment = regexp.MustCompile(`(^|\s)#.*$`)
+
+// readLinks with one on each line
+// empty lines and comments that start with # are skipped
+func readLinks(r io.Reader) ([]string, error) {
+	var links []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(webComment.ReplaceAllString(s.Text(), ""))
+		if line != "" {
+			links = append(links, line)
+		}
+	}
+	return links, s.Err()
+}
+
+// isPiped is true if we were given something on stdin
+func isPiped() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// what happened to a link we were given
+type webResult struct {
+	link   string
+	status string
+	images int
+	err    error
+}
+
+// completeWebHosts so the rest of a link can be pasted
+func completeWebHosts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	for _, h := range scrape.Hosts() {
+		link := "https://" + h + "/"
+		if strings.HasPrefix(link, toComplete) {
+			completions = append(completions, link)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
 }
 
 var webCmd = &cobra.Command{
-	Use:   "web [urls]",
-	Short: "Save all images from a url with supported hostnames",
+	Use:               "web [urls]",
+	Short:             "Save all images from a url with supported hostnames",
+	ValidArgsFunction: completeWebHosts,
 	Args: func(cmd *cobra.Command, args []string) (err error) {
-		if len(args) < 1 {
+		if len(args) < 1 && webInput == "" && !isPiped() {
 			return errors.New("We need a website to gather images from")
 		}
 
@@ -39,248 +96,112 @@ var webCmd = &cobra.Command{
 		// create save directory if it does not exist
 		err := os.MkdirAll(saveWebImagesTo, os.ModePerm)
 		if err != nil {
-			panic(err)
+			fmt.Println("[nok]", err)
+			return
 		}
 
-		// parse given links
-		var urls []*url.URL
-		for _, link := range args {
-			u, err := url.ParseRequestURI(link)
+		if err := scrape.LoadRules(); err != nil {
+			fmt.Println("[nok]", err)
+			return
+		}
+
+		links := args
+		if webInput != "" || (len(args) == 0 && isPiped()) {
+			in := os.Stdin
+			if webInput != "" && webInput != "-" {
+				f, err := os.Open(webInput)
+				if err != nil {
+					fmt.Println("[nok]", err)
+					return
+				}
+				defer f.Close()
+				in = f
+			}
+			more, err := readLinks(in)
 			if err != nil {
-				fmt.Println("Parse error:", err)
+				fmt.Println("[nok]", err)
 				return
 			}
-			urls = append(urls, u)
+			links = append(links, more...)
+		}
+
+		history, err := scrape.LoadHistory(filepath.Join(options.ConfigPath, scrape.HistoryFilename))
+		if err != nil {
+			fmt.Println("[nok]", err)
+			return
 		}
 
 		ctx := context.Background()
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		browser := gochrome.NewBrowser()
-		browser.UserAgent = options.Get("user_agent")
+		// chrome is started when we open the first page
+		defer browser.Close()
 
-		_, err = browser.Start(ctx, gochrome.TemporaryUserProfileDirectory, port)
-		if err != nil {
-			panic(err)
-		}
-		defer browser.Wait()
+		go fetch.ShowProgress(ctx, progressEvery)
 
-		if verbose {
-			gochrome.Log = log.Printf
+		// each link we were given once in the order we were given them
+		var results []*webResult
+		seen := make(map[string]bool)
+		for _, link := range links {
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			results = append(results, &webResult{link: link})
 		}
 
+		jobs := make(chan struct{}, options.GetInt("jobs"))
 		var wg sync.WaitGroup
-		for _, u := range urls {
-			switch u.Host {
-			case "hustlepress.co.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('img.size-full')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "ray-web.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('.scale_full > a > img,.top_photo > img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "bisweb.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[
-							...document.querySelector(".tieup_wrap").querySelectorAll("p > img")
-						].map(el => el.src)
-						.concat([document.querySelector(".single_kv").style.backgroundImage.slice(5, -2)])
-						.toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "mdpr.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					if !strings.Contains(l, "photo") {
-						// todo: maybe add support for news page
-						fmt.Println("We need https://mdpr.jp/photo/detail/{num}")
-						return
-					}
-					jsCode := `[...document.querySelectorAll('img.c-image__image, .pg-photo__webImageListLink > img')].map(el => {
-							link = el.src;
-							return link.slice(0, link.indexOf('?'));
-						}).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "tokyopopline.com":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					var jsCode string
-					if strings.Contains(l, "archives") {
-						jsCode = `[...document.querySelector('main').querySelectorAll(".gallery-icon > a")].map(el => el.href).toString()`
-					} else {
-						jsCode = `[document.querySelector('main').querySelector(".entry-thumbnail > img"), ...document.querySelectorAll('.gallery-icon > a')].map(el => el.src || el.href).toString()`
-					}
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "taishu.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					if !strings.Contains(l, "photo") {
-						fmt.Println("We need https://taishu.jp/articles/photo/{num}")
-						return
-					}
-					jsCode := `[...document.querySelectorAll('.swiper-slide > figure > img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "cancam.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('a')].filter(el => el.href.includes('.jpg')).map(el => el.href).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "jj-jj.net":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('img')].filter(i => i.width >= 600).map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "news.dwango.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('.stop-tap > img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "news.mynavi.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('.photo_table__link')].map(el => el.href.replace('/photo', '')).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "lineblog.me":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('img.pict')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "nonno.hpplus.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('.article > .part .image figure > div > img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "abematimes.com":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('.blog-article__content').querySelectorAll('.img__item > img')].map(el => {
-							link = el.src;
-							return link.includes('?') ? link.slice(0, link.indexOf('?')) : link;
-						}).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "bltweb.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('.mh-content').querySelectorAll('img')]
-						.filter(i => i.width >= 300)
-						.map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "image.itmedia.co.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('#imgThumb_in').querySelectorAll('a')]
-						.map(el => el.href.replace('/l/im', '')).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "ar-mag.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('.posts__contents').querySelectorAll('img')]
-						.filter(i => i.width >= 300)
-						.map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "www.nikkansports.com":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelectorAll('.article-main img[style]')]
-						.map(el => el.style.backgroundImage.slice(5, -2))
-						.map(url => url.replace('w200', 'w1300'))
-						.map(url => url.replace('w500', 'w1300'))
-						.toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "news.line.me":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('section').querySelectorAll('img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "girlswalker.com":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					jsCode := `[...document.querySelector('.gw-content__entry-article').querySelectorAll('img')].map(el => el.src).toString()`
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			case "thetv.jp":
-				wg.Add(1)
-				go func(l string) {
-					defer wg.Done()
-					base := path.Base(u.Path)
-					jsCode := fmt.Sprintf(`[...document.querySelector('.galleryArea').querySelectorAll('a')]
-							.map(el => new URL(el.href).pathname.split('/').slice(-2)[0])
-							.map(name => 'https://thetv.jp/i/nw/%s/' + name + '.jpg')
-							.toString()`, base)
-					fmt.Printf("Saving all images from %s to %s\n", l, saveWebImagesTo)
-					scrape.SaveImagesFrom(ctx, browser, l, saveWebImagesTo, jsCode)
-				}(u.String())
-			default:
-				fmt.Println("We cannot handle:", u.String())
+		for _, r := range results {
+			u, err := url.ParseRequestURI(r.link)
+			if err != nil {
+				r.status, r.err = "nok", err
+				continue
 			}
+			rule, err := scrape.FindRule(u.String())
+			if err != nil {
+				r.status, r.err = "nok", err
+				continue
+			}
+			if v, ok := history.Visited(r.link); ok && !shouldScrapeAgain {
+				r.status, r.images = "skip", v.Images
+				r.err = fmt.Errorf("saved %s to %s", v.Saved.Format("2006-01-02"), v.SaveTo)
+				continue
+			}
+
+			wg.Add(1)
+			go func(r *webResult) {
+				defer wg.Done()
+				select {
+				case jobs <- struct{}{}:
+					defer func() { <-jobs }()
+				case <-ctx.Done():
+					r.status, r.err = "nok", errors.New("We stopped before we started it")
+					return
+				}
+				fmt.Printf("Saving all images from %s to %s\n", r.link, saveWebImagesTo)
+				r.images, r.err = scrape.SaveImagesFrom(ctx, rule, r.link, saveWebImagesTo)
+				if r.err != nil {
+					r.status = "nok"
+					fmt.Println("[nok]", r.err)
+					return
+				}
+				r.status = "ok"
+				history.Add(r.link, r.images, saveWebImagesTo)
+			}(r)
 		}
 
+		done := make(chan struct{})
 		go func() {
 			wg.Wait()
-			cancel()
+			fetch.PrintSummary()
+			printWebSummary(results)
+			close(done)
 		}()
 
 		// handle interrupt
+		// links in progress stop and we still show the summary
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, os.Interrupt)
 
@@ -289,9 +210,29 @@ var webCmd = &cobra.Command{
 			case <-sig:
 				signal.Stop(sig)
 				cancel()
-			case <-ctx.Done():
+			case <-done:
 				return
 			}
 		}
 	},
 }
+
+// printWebSummary with what happened to each link
+func printWebSummary(results []*webResult) {
+	var ok, skipped, failed, images int
+	for _, r := range results {
+		switch r.status {
+		case "ok":
+			ok++
+			images += r.images
+			fmt.Printf("[ok] %s %d images\n", r.link, r.images)
+		case "skip":
+			skipped++
+			fmt.Printf("[skip] %s %s\n", r.link, r.err)
+		default:
+			failed++
+			fmt.Printf("[nok] %s %s\n", r.link, r.err)
+		}
+	}
+	fmt.Printf("We saved %d images from %d links, skipped %d we saved before and %d failed\n", images, ok, skipped, failed)
+}
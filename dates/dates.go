@@ -0,0 +1,356 @@
+// Package dates understands the dates people type such as 2021-03, 3 weeks ago or 先週
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tokyo is where the site posts blogs so every date is a day there
+var Tokyo = tokyo()
+
+func tokyo() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		// we may not have the time zone database but tokyo has no daylight saving
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}
+
+// Range of time from From up to but not including Until
+// a zero From is forever ago and a zero Until is now
+type Range struct {
+	From  time.Time
+	Until time.Time
+}
+
+// Contains is true if t is in the range
+func (r Range) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !t.Before(r.Until) {
+		return false
+	}
+	return true
+}
+
+// Days in the range in order
+// a range that goes on until now ends with today
+func (r Range) Days(now time.Time) []time.Time {
+	until := r.Until
+	if until.IsZero() {
+		until = Day(now).AddDate(0, 0, 1)
+	}
+	var days []time.Time
+	for d := Day(r.From); d.Before(until); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// Days in any of the ranges in order without repeating a day
+func Days(now time.Time, ranges ...Range) []time.Time {
+	seen := make(map[time.Time]bool)
+	var days []time.Time
+	for _, r := range ranges {
+		for _, d := range r.Days(now) {
+			if !seen[d] {
+				seen[d] = true
+				days = append(days, d)
+			}
+		}
+	}
+	sort.Slice(days, func(a, b int) bool {
+		return days[a].Before(days[b])
+	})
+	return days
+}
+
+func (r Range) String() string {
+	from := "forever"
+	if !r.From.IsZero() {
+		from = r.From.Format("2006-01-02")
+	}
+	if r.Until.IsZero() {
+		return from + ".."
+	}
+	// Until is not in the range so we show the last day
+	return from + ".." + r.Until.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// Day that t is in tokyo
+func Day(t time.Time) time.Time {
+	y, m, d := t.In(Tokyo).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, Tokyo)
+}
+
+// Parse a date such as today, 2021-03-05, 20210305, 2021-03, 2021, 3 weeks ago, 7, 先月 or 令和3年
+// and the range of time it means so 2021-03 is all of march
+// two dates with .. between them such as 2020-01..2020-03 go from the first to the end of the last
+// either side may be left out to go on forever or until now
+func Parse(expr string, now time.Time) (Range, error) {
+	expr = clean(expr)
+
+	for _, sep := range []string{"..", "〜", "~"} {
+		i := strings.Index(expr, sep)
+		if i < 0 {
+			continue
+		}
+		var r Range
+		if from := strings.TrimSpace(expr[:i]); from != "" {
+			f, err := parse(from, now)
+			if err != nil {
+				return Range{}, err
+			}
+			r.From = f.From
+		}
+		if until := strings.TrimSpace(expr[i+len(sep):]); until != "" {
+			u, err := parse(until, now)
+			if err != nil {
+				return Range{}, err
+			}
+			r.Until = u.Until
+		}
+		if !r.From.IsZero() && !r.Until.IsZero() && !r.From.Before(r.Until) {
+			return Range{}, fmt.Errorf("%q ends before it starts", expr)
+		}
+		return r, nil
+	}
+
+	return parse(expr, now)
+}
+
+// Since parses expr as where a range starts
+// a range such as 2020-01..2020-03 keeps its end but anything else goes on until now
+func Since(expr string, now time.Time) (Range, error) {
+	r, err := Parse(expr, now)
+	if err != nil {
+		return Range{}, err
+	}
+	if !isRange(expr) {
+		r.Until = time.Time{}
+	}
+	return r, nil
+}
+
+// Until parses expr as where a range ends including all of it so until 2021-03 is the end of march
+func Until(expr string, now time.Time) (time.Time, error) {
+	r, err := Parse(expr, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.Until, nil
+}
+
+func isRange(expr string) bool {
+	return strings.Contains(expr, "..") || strings.ContainsAny(expr, "〜~")
+}
+
+// keywords for a period of time around now
+// the value gives the unit and how many of them before now
+var keywords = map[string]struct {
+	unit string
+	ago  int
+}{
+	"today":      {"day", 0},
+	"今日":         {"day", 0},
+	"本日":         {"day", 0},
+	"yesterday":  {"day", 1},
+	"昨日":         {"day", 1},
+	"一昨日":        {"day", 2},
+	"おととい":       {"day", 2},
+	"week":       {"week", 0},
+	"this week":  {"week", 0},
+	"今週":         {"week", 0},
+	"last week":  {"week", 1},
+	"先週":         {"week", 1},
+	"month":      {"month", 0},
+	"this month": {"month", 0},
+	"今月":         {"month", 0},
+	"last month": {"month", 1},
+	"先月":         {"month", 1},
+	"year":       {"year", 0},
+	"this year":  {"year", 0},
+	"今年":         {"year", 0},
+	"last year":  {"year", 1},
+	"去年":         {"year", 1},
+	"昨年":         {"year", 1},
+}
+
+// units people write in a relative date
+var units = map[string]string{
+	"day": "day", "days": "day", "日": "day",
+	"week": "week", "weeks": "week", "週": "week", "週間": "week",
+	"month": "month", "months": "month", "ヶ月": "month", "か月": "month", "カ月": "month", "ケ月": "month", "ヵ月": "month",
+	"year": "year", "years": "year", "年": "year",
+}
+
+var (
+	relative = regexp.MustCompile(`^(\d+)\s*([a-z]+|日|週間|週|[ヶかカケヵ]月|年)\s*(ago|前)$`)
+	numeric  = regexp.MustCompile(`^(\d{4})(?:[-./](\d{1,2})(?:[-./](\d{1,2}))?)?$`)
+	compact  = regexp.MustCompile(`^(\d{4})(\d{2})(\d{2})$`)
+	daysAgo  = regexp.MustCompile(`^\d{1,3}$`)
+	negative = regexp.MustCompile(`^-\d+$`)
+	japanese = regexp.MustCompile(`^(明治|大正|昭和|平成|令和)?(\d+|元)年(?:(\d{1,2})月(?:(\d{1,2})日)?)?$`)
+)
+
+// the year before each era began so 令和1年 is 2019
+var eras = map[string]int{
+	"明治": 1867,
+	"大正": 1911,
+	"昭和": 1925,
+	"平成": 1988,
+	"令和": 2018,
+}
+
+// parse one date that is not a range
+func parse(expr string, now time.Time) (Range, error) {
+	today := Day(now)
+
+	switch expr {
+	case "":
+		return period(today, "day"), nil
+	case "forever", "all", "全部":
+		return Range{}, nil
+	}
+
+	if k, ok := keywords[expr]; ok {
+		return ago(today, k.unit, k.ago), nil
+	}
+
+	// a number of days ago
+	// four digits are a year so 1000 days is written 1000 days ago
+	if daysAgo.MatchString(expr) {
+		n, _ := strconv.Atoi(expr)
+		return ago(today, "day", n), nil
+	}
+	if negative.MatchString(expr) {
+		return Range{}, errors.New("Number of days must be positive")
+	}
+
+	if m := relative.FindStringSubmatch(expr); m != nil {
+		unit, ok := units[m[2]]
+		if !ok {
+			return Range{}, fmt.Errorf("We do not know the unit %q in %q", m[2], expr)
+		}
+		// this is the day that long ago rather than the whole week or month
+		n, _ := strconv.Atoi(m[1])
+		switch unit {
+		case "week":
+			return period(today.AddDate(0, 0, -7*n), "day"), nil
+		case "month":
+			return period(today.AddDate(0, -n, 0), "day"), nil
+		case "year":
+			return period(today.AddDate(-n, 0, 0), "day"), nil
+		}
+		return period(today.AddDate(0, 0, -n), "day"), nil
+	}
+
+	if m := numeric.FindStringSubmatch(expr); m != nil {
+		return date(expr, m[1], m[2], m[3])
+	}
+	if m := compact.FindStringSubmatch(expr); m != nil {
+		return date(expr, m[1], m[2], m[3])
+	}
+
+	if m := japanese.FindStringSubmatch(expr); m != nil {
+		year := m[2]
+		if year == "元" {
+			year = "1"
+		}
+		if m[1] != "" {
+			n, _ := strconv.Atoi(year)
+			if n < 1 {
+				return Range{}, fmt.Errorf("%q is not a year", expr)
+			}
+			year = strconv.Itoa(eras[m[1]] + n)
+		}
+		return date(expr, year, m[3], m[4])
+	}
+
+	return Range{}, fmt.Errorf("We do not understand the date %q", expr)
+}
+
+// date from its parts where month and day may be empty
+func date(expr string, year string, month string, day string) (Range, error) {
+	y, _ := strconv.Atoi(year)
+	m, d := 1, 1
+	unit := "year"
+	if month != "" {
+		m, _ = strconv.Atoi(month)
+		unit = "month"
+	}
+	if day != "" {
+		d, _ = strconv.Atoi(day)
+		unit = "day"
+	}
+
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, Tokyo)
+	if t.Year() != y || int(t.Month()) != m || t.Day() != d {
+		return Range{}, fmt.Errorf("%q is not a date", expr)
+	}
+	return period(t, unit), nil
+}
+
+// ago is the period n units before the one today is in
+func ago(today time.Time, unit string, n int) Range {
+	switch unit {
+	case "week":
+		return period(today.AddDate(0, 0, -7*n), unit)
+	case "month":
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, Tokyo)
+		return period(first.AddDate(0, -n, 0), unit)
+	case "year":
+		return period(today.AddDate(-n, 0, 0), unit)
+	default:
+		return period(today.AddDate(0, 0, -n), unit)
+	}
+}
+
+// period of one unit that day is in
+// a week starts on sunday
+func period(day time.Time, unit string) Range {
+	y, m, d := day.Date()
+	switch unit {
+	case "week":
+		from := time.Date(y, m, d-int(day.Weekday()), 0, 0, 0, 0, Tokyo)
+		return Range{From: from, Until: from.AddDate(0, 0, 7)}
+	case "month":
+		from := time.Date(y, m, 1, 0, 0, 0, 0, Tokyo)
+		return Range{From: from, Until: from.AddDate(0, 1, 0)}
+	case "year":
+		from := time.Date(y, 1, 1, 0, 0, 0, 0, Tokyo)
+		return Range{From: from, Until: from.AddDate(1, 0, 0)}
+	default:
+		from := time.Date(y, m, d, 0, 0, 0, 0, Tokyo)
+		return Range{From: from, Until: from.AddDate(0, 0, 1)}
+	}
+}
+
+// clean up what someone typed so full width digits and case do not matter
+func clean(expr string) string {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	expr = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '０' && r <= '９':
+			return r - '０' + '0'
+		case r == '　':
+			return ' '
+		case r == '／':
+			return '/'
+		case r == '－':
+			return '-'
+		case r == '．':
+			return '.'
+		}
+		return r
+	}, expr)
+	return strings.Join(strings.Fields(expr), " ")
+}
@@ -0,0 +1,222 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+// a wednesday at noon in tokyo
+var now = time.Date(2021, 3, 10, 12, 0, 0, 0, Tokyo)
+
+// day in tokyo or the zero time for an empty string
+func day(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, Tokyo)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr  string
+		from  string
+		until string
+	}{
+		// keywords
+		{"", "2021-03-10", "2021-03-11"},
+		{"today", "2021-03-10", "2021-03-11"},
+		{"Today", "2021-03-10", "2021-03-11"},
+		{"今日", "2021-03-10", "2021-03-11"},
+		{"yesterday", "2021-03-09", "2021-03-10"},
+		{"昨日", "2021-03-09", "2021-03-10"},
+		{"一昨日", "2021-03-08", "2021-03-09"},
+		{"week", "2021-03-07", "2021-03-14"},
+		{"last week", "2021-02-28", "2021-03-07"},
+		{"先週", "2021-02-28", "2021-03-07"},
+		{"month", "2021-03-01", "2021-04-01"},
+		{"last month", "2021-02-01", "2021-03-01"},
+		{"先月", "2021-02-01", "2021-03-01"},
+		{"year", "2021-01-01", "2022-01-01"},
+		{"去年", "2020-01-01", "2021-01-01"},
+		{"forever", "", ""},
+		{"全部", "", ""},
+
+		// days ago
+		{"0", "2021-03-10", "2021-03-11"},
+		{"7", "2021-03-03", "2021-03-04"},
+		{"７", "2021-03-03", "2021-03-04"},
+		{"999", "2018-06-15", "2018-06-16"},
+
+		// relative dates are the day that long ago
+		{"3 days ago", "2021-03-07", "2021-03-08"},
+		{"3日前", "2021-03-07", "2021-03-08"},
+		{"1000 days ago", "2018-06-14", "2018-06-15"},
+		{"3 weeks ago", "2021-02-17", "2021-02-18"},
+		{"3週間前", "2021-02-17", "2021-02-18"},
+		{"2 months ago", "2021-01-10", "2021-01-11"},
+		{"2ヶ月前", "2021-01-10", "2021-01-11"},
+		{"２か月前", "2021-01-10", "2021-01-11"},
+		{"1 year ago", "2020-03-10", "2020-03-11"},
+		{"1年前", "2020-03-10", "2020-03-11"},
+
+		// days, months and years
+		{"2021-03-05", "2021-03-05", "2021-03-06"},
+		{"2021-3-5", "2021-03-05", "2021-03-06"},
+		{"2021/03/05", "2021-03-05", "2021-03-06"},
+		{"2021.03.05", "2021-03-05", "2021-03-06"},
+		{"20210305", "2021-03-05", "2021-03-06"},
+		{"２０２１－０３－０５", "2021-03-05", "2021-03-06"},
+		{"２０２１／０３／０５", "2021-03-05", "2021-03-06"},
+		{"2021-03", "2021-03-01", "2021-04-01"},
+		{"2021", "2021-01-01", "2022-01-01"},
+		{"2021年3月5日", "2021-03-05", "2021-03-06"},
+		{"２０２１年３月５日", "2021-03-05", "2021-03-06"},
+		{"2021年3月", "2021-03-01", "2021-04-01"},
+		{"2021年", "2021-01-01", "2022-01-01"},
+
+		// eras
+		{"令和3年", "2021-01-01", "2022-01-01"},
+		{"令和元年", "2019-01-01", "2020-01-01"},
+		{"令和元年5月1日", "2019-05-01", "2019-05-02"},
+		{"平成31年4月30日", "2019-04-30", "2019-05-01"},
+		{"平成元年", "1989-01-01", "1990-01-01"},
+		{"昭和64年", "1989-01-01", "1990-01-01"},
+		{"大正15年", "1926-01-01", "1927-01-01"},
+		{"明治45年", "1912-01-01", "1913-01-01"},
+
+		// ranges
+		{"2020-01..2020-03", "2020-01-01", "2020-04-01"},
+		{"2020-01〜2020-03", "2020-01-01", "2020-04-01"},
+		{"2020-01~2020-03", "2020-01-01", "2020-04-01"},
+		{"2020-01 .. 2020-03", "2020-01-01", "2020-04-01"},
+		{"2021-03-01..", "2021-03-01", ""},
+		{"..2020", "", "2021-01-01"},
+		{"令和2年..令和3年", "2020-01-01", "2022-01-01"},
+		{"last month..yesterday", "2021-02-01", "2021-03-10"},
+		{"2021-03-05..2021-03-05", "2021-03-05", "2021-03-06"},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.expr, now)
+		if err != nil {
+			t.Errorf("Parse(%q) error %s", tt.expr, err)
+			continue
+		}
+		want := Range{From: day(tt.from), Until: day(tt.until)}
+		if !got.From.Equal(want.From) || !got.Until.Equal(want.Until) {
+			t.Errorf("Parse(%q) = %s want %s", tt.expr, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"-3",
+		"-30",
+		"+3",
+		"12345",
+		"201903",
+		"20190230",
+		"2021-02-30",
+		"2021-13",
+		"2021年2月30日",
+		"令和0年",
+		"2021-03..2020-01",
+		"5 fortnights ago",
+		"whenever",
+	}
+
+	for _, expr := range tests {
+		if got, err := Parse(expr, now); err == nil {
+			t.Errorf("Parse(%q) = %s want an error", expr, got)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	tests := []struct {
+		expr  string
+		from  string
+		until string
+	}{
+		// since a date goes on until now
+		{"2021-03", "2021-03-01", ""},
+		{"week", "2021-03-07", ""},
+		{"forever", "", ""},
+		// a range keeps its end
+		{"2020-01..2020-03", "2020-01-01", "2020-04-01"},
+	}
+
+	for _, tt := range tests {
+		got, err := Since(tt.expr, now)
+		if err != nil {
+			t.Errorf("Since(%q) error %s", tt.expr, err)
+			continue
+		}
+		want := Range{From: day(tt.from), Until: day(tt.until)}
+		if !got.From.Equal(want.From) || !got.Until.Equal(want.Until) {
+			t.Errorf("Since(%q) = %s want %s", tt.expr, got, want)
+		}
+	}
+}
+
+func TestUntil(t *testing.T) {
+	tests := []struct {
+		expr  string
+		until string
+	}{
+		{"2021-03", "2021-04-01"},
+		{"2021-03-05", "2021-03-06"},
+		{"令和2年", "2021-01-01"},
+		{"yesterday", "2021-03-10"},
+	}
+
+	for _, tt := range tests {
+		got, err := Until(tt.expr, now)
+		if err != nil {
+			t.Errorf("Until(%q) error %s", tt.expr, err)
+			continue
+		}
+		if !got.Equal(day(tt.until)) {
+			t.Errorf("Until(%q) = %s want %s", tt.expr, got, tt.until)
+		}
+	}
+}
+
+func TestDays(t *testing.T) {
+	a, _ := Parse("2021-03-09..", now)
+	b, _ := Parse("2021-03-01..2021-03-02", now)
+	c, _ := Parse("2021-03-10", now)
+
+	got := Days(now, a, b, c)
+	want := []string{"2021-03-01", "2021-03-02", "2021-03-09", "2021-03-10"}
+	if len(got) != len(want) {
+		t.Fatalf("Days() = %v want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(day(want[i])) {
+			t.Errorf("Days()[%d] = %s want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	tests := []struct {
+		r    Range
+		want string
+	}{
+		{Range{}, "forever.."},
+		{Range{From: day("2021-03-01")}, "2021-03-01.."},
+		{Range{From: day("2021-03-01"), Until: day("2021-04-01")}, "2021-03-01..2021-03-31"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("String() = %q want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+	"golang.org/x/time/rate"
+)
+
+// the smallest read we make when limiting bandwidth
+const minReadSize = 4096
+
+// bandwidth limits in bytes per second given with LimitRate
+var bandwidth = struct {
+	sync.Mutex
+	// true once global is set from the options or LimitRate
+	loaded bool
+	global *rate.Limiter
+	hosts  map[string]int64
+}{hosts: make(map[string]int64)}
+
+// ParseRate like 500k or 2M in bytes per second
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "B")
+	if s == "" {
+		return 0, fmt.Errorf("fetch.ParseRate: empty rate")
+	}
+
+	mult := int64(1)
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		mult = 1 << 10
+	case 'm', 'M':
+		mult = 1 << 20
+	case 'g', 'G':
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("fetch.ParseRate: %q is not a rate like 500k or 2M", s)
+	}
+
+	return int64(n * float64(mult)), nil
+}
+
+// LimitRate of every download to a host in bytes per second
+// host is empty to limit all downloads together and zero means no limit
+func LimitRate(host string, bytesPerSecond int64) {
+	bandwidth.Lock()
+	if host == "" {
+		bandwidth.loaded = true
+		bandwidth.global = newBandwidthLimiter(bytesPerSecond)
+		bandwidth.Unlock()
+		return
+	}
+	bandwidth.hosts[host] = bytesPerSecond
+	bandwidth.Unlock()
+
+	// getHost takes the locks the other way around so we let go first
+	hosts.Lock()
+	h, ok := hosts.m[host]
+	hosts.Unlock()
+	if ok {
+		h.setBandwidth(bytesPerSecond)
+	}
+}
+
+// LimitRates from a list like 1M or cdn.hinatazaka46.com=200k
+func LimitRates(specs []string) error {
+	for _, spec := range specs {
+		host := ""
+		r := spec
+		if i := strings.IndexByte(spec, '='); i >= 0 {
+			host, r = spec[:i], spec[i+1:]
+		}
+		n, err := ParseRate(r)
+		if err != nil {
+			return err
+		}
+		LimitRate(host, n)
+	}
+	return nil
+}
+
+// GlobalRate we limit all downloads to in bytes per second or zero
+func GlobalRate() int64 {
+	l := globalLimiter()
+	if l == nil {
+		return 0
+	}
+	return int64(l.Limit())
+}
+
+func globalLimiter() *rate.Limiter {
+	bandwidth.Lock()
+	defer bandwidth.Unlock()
+
+	if !bandwidth.loaded {
+		bandwidth.loaded = true
+		if s := options.Get("limit_rate"); s != "" {
+			n, err := ParseRate(s)
+			if err != nil {
+				log.Printf("fetch: limit_rate: %s", err)
+			}
+			bandwidth.global = newBandwidthLimiter(n)
+		}
+	}
+
+	return bandwidth.global
+}
+
+// hostRate given with LimitRate
+func hostRate(host string) (int64, bool) {
+	bandwidth.Lock()
+	defer bandwidth.Unlock()
+
+	n, ok := bandwidth.hosts[host]
+	return n, ok
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := int(bytesPerSecond)
+	if burst < minReadSize {
+		burst = minReadSize
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// meteredBody counts what we read and keeps to our bandwidth limits
+type meteredBody struct {
+	body  io.ReadCloser
+	ctx   context.Context
+	host  *host
+	label string
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	limiters := []*rate.Limiter{globalLimiter(), b.host.bandwidthLimiter()}
+
+	for _, l := range limiters {
+		if l != nil && len(p) > l.Burst() {
+			p = p[:l.Burst()]
+		}
+	}
+
+	n, err := b.body.Read(p)
+	if n > 0 {
+		count(b.host.name, b.label, n)
+		for _, l := range limiters {
+			if l == nil {
+				continue
+			}
+			if werr := l.WaitN(b.ctx, n); werr != nil && err == nil {
+				err = werr
+			}
+		}
+	}
+
+	return n, err
+}
+
+func (b *meteredBody) Close() error {
+	return b.body.Close()
+}
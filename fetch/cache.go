@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/internal/file"
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// Offline replays responses from the cache instead of using the network
+var Offline bool
+
+// ErrNotCached is returned when we are offline and have never fetched a link
+var ErrNotCached = errors.New("not in cache")
+
+// Cache is an http.RoundTripper that keeps responses on disk
+// and asks the host if they changed before using them again
+type Cache struct {
+	// Next does the actual request
+	Next http.RoundTripper
+}
+
+// NewCache that keeps responses we get from next
+func NewCache(next http.RoundTripper) *Cache {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Cache{Next: next}
+}
+
+// what we know about a response in the cache
+// the body is kept in its own file
+type cached struct {
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// RoundTrip uses the cache when we can
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	link := req.URL.String()
+
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" || (!Offline && !options.GetBool("use_cache")) {
+		if Offline {
+			return nil, fmt.Errorf("fetch: %s: %w", link, ErrNotCached)
+		}
+		return c.Next.RoundTrip(req)
+	}
+
+	path := cachePath(link)
+	entry, err := readCached(path)
+
+	if Offline {
+		if err != nil {
+			return nil, fmt.Errorf("fetch: %s: %w", link, ErrNotCached)
+		}
+		return entry.response(req, path)
+	}
+
+	// ask if what we have is still good
+	r := req
+	if entry != nil {
+		r = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" && r.Header.Get("If-Modified-Since") == "" {
+			r.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	res, err := c.Next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && entry != nil {
+		res.Body.Close()
+		// the host may send fresh validators with the 304
+		for _, k := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires"} {
+			if v := res.Header.Get(k); v != "" {
+				entry.Header.Set(k, v)
+			}
+		}
+		entry.StoredAt = time.Now()
+		if err := file.Write(path+".json", entry.marshal(), 0600); err != nil {
+			return nil, err
+		}
+		return entry.response(req, path)
+	}
+
+	if res.StatusCode != http.StatusOK || noStore(res.Header) {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry = &cached{
+		URL:      link,
+		Status:   res.StatusCode,
+		Header:   res.Header.Clone(),
+		StoredAt: time.Now(),
+	}
+	if err := file.Write(path+".body", body, 0600); err != nil {
+		return nil, err
+	}
+	if err := file.Write(path+".json", entry.marshal(), 0600); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// noStore is true if the host asks us not to keep the response
+// such as with Cache-Control: private, no-store
+func noStore(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cachePath of a link without an extension
+func cachePath(link string) string {
+	h := sha1.Sum([]byte(link))
+	key := hex.EncodeToString(h[:])
+	return filepath.Join(options.Get("cache_dir"), key[:2], key)
+}
+
+func readCached(path string) (*cached, error) {
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cached
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (entry *cached) marshal() []byte {
+	data, _ := json.Marshal(entry)
+	return data
+}
+
+// response that was cached at path
+func (entry *cached) response(req *http.Request, path string) (*http.Response, error) {
+	f, err := os.Open(path + ".body")
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	header := entry.Header.Clone()
+	header.Set("X-From-Cache", "1")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          f,
+		ContentLength: stat.Size(),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,311 @@
+// Package fetch keeps us polite to the hosts we download from
+//
+// Every host gets a token bucket rate limit, a limit on requests in flight
+// that shrinks when the host starts failing and a robots.txt check.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+	"golang.org/x/time/rate"
+)
+
+// ErrDisallowed is returned when robots.txt does not allow a link
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// DefaultRetryAfter is how long we back off when a host is busy but does not say for how long
+var DefaultRetryAfter = 30 * time.Second
+
+// HostOption overrides options for one host
+// in options.toml:
+//
+//	[[hosts]]
+//	host = "cdn.hinatazaka46.com"
+//	rate_limit = 4.0
+//	rate_burst = 8
+//	concurrency = 4
+//	limit_rate = "500k"
+type HostOption struct {
+	Host        string  `mapstructure:"host"`
+	RateLimit   float64 `mapstructure:"rate_limit"`
+	RateBurst   int     `mapstructure:"rate_burst"`
+	Concurrency int     `mapstructure:"concurrency"`
+	LimitRate   string  `mapstructure:"limit_rate"`
+}
+
+var hosts = struct {
+	sync.Mutex
+	m map[string]*host
+}{m: make(map[string]*host)}
+
+// getHost state for a hostname
+func getHost(name string) *host {
+	hosts.Lock()
+	defer hosts.Unlock()
+
+	if h, ok := hosts.m[name]; ok {
+		return h
+	}
+
+	o := HostOption{
+		Host:        name,
+		RateLimit:   options.GetFloat64("rate_limit"),
+		RateBurst:   options.GetInt("rate_burst"),
+		Concurrency: options.GetInt("host_concurrency"),
+	}
+
+	var overrides []HostOption
+	if err := options.UnmarshalKey("hosts", &overrides); err != nil {
+		log.Printf("fetch: hosts: %s", err)
+	}
+	for _, ho := range overrides {
+		if ho.Host != name {
+			continue
+		}
+		if ho.RateLimit > 0 {
+			o.RateLimit = ho.RateLimit
+		}
+		if ho.RateBurst > 0 {
+			o.RateBurst = ho.RateBurst
+		}
+		if ho.Concurrency > 0 {
+			o.Concurrency = ho.Concurrency
+		}
+		if ho.LimitRate != "" {
+			o.LimitRate = ho.LimitRate
+		}
+	}
+
+	h := newHost(o)
+	hosts.m[name] = h
+
+	// a limit from the command line beats the options
+	if n, ok := hostRate(name); ok {
+		h.setBandwidth(n)
+	} else if o.LimitRate != "" {
+		n, err := ParseRate(o.LimitRate)
+		if err != nil {
+			log.Printf("fetch: hosts: %s: %s", name, err)
+		}
+		h.setBandwidth(n)
+	}
+
+	return h
+}
+
+func hostOf(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return u.Hostname(), nil
+}
+
+// Acquire waits until we may make a request to the host of link
+// call release with whether the request went well once it is done
+func Acquire(ctx context.Context, link string) (release func(ok bool), err error) {
+	name, err := hostOf(link)
+	if err != nil {
+		return nil, err
+	}
+
+	h := getHost(name)
+	if err := h.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	return h.release, nil
+}
+
+// Backoff from the host of link for a while
+// we use DefaultRetryAfter if d is zero
+func Backoff(link string, d time.Duration) {
+	name, err := hostOf(link)
+	if err != nil {
+		return
+	}
+	if d <= 0 {
+		d = DefaultRetryAfter
+	}
+	log.Printf("fetch: backoff from %s for %s", name, d)
+	getHost(name).backoff(d)
+}
+
+// host is what we know about a single host
+type host struct {
+	name    string
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+	// max requests in flight and what we allow right now
+	max   int
+	limit int
+	// requests in flight
+	active int
+	// closed when a request finishes
+	wake chan struct{}
+	// recent results used to adapt limit
+	results []bool
+	// successes in a row
+	streak int
+	// do not make requests before this
+	retryAt time.Time
+	// limits bytes per second we download from this host
+	bandwidth *rate.Limiter
+}
+
+const (
+	// how many results we look at when deciding to slow down
+	resultWindow = 20
+	// how many results we need before we decide
+	minResults = 8
+	// we slow down when this many results are errors
+	maxErrorRate = 0.25
+)
+
+func newHost(o HostOption) *host {
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	if o.RateBurst < 1 {
+		o.RateBurst = 1
+	}
+	limit := rate.Limit(o.RateLimit)
+	if o.RateLimit <= 0 {
+		limit = rate.Inf
+	}
+
+	return &host{
+		name:    o.Host,
+		limiter: rate.NewLimiter(limit, o.RateBurst),
+		max:     o.Concurrency,
+		limit:   o.Concurrency,
+		wake:    make(chan struct{}),
+	}
+}
+
+func (h *host) acquire(ctx context.Context) error {
+	for {
+		h.mu.Lock()
+		if h.active < h.limit {
+			h.active++
+			h.mu.Unlock()
+			break
+		}
+		wake := h.wake
+		h.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+
+	h.mu.Lock()
+	wait := time.Until(h.retryAt)
+	h.mu.Unlock()
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			h.done()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if err := h.limiter.Wait(ctx); err != nil {
+		h.done()
+		return err
+	}
+
+	return nil
+}
+
+// done with a request without counting it
+func (h *host) done() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.active--
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+func (h *host) release(ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.active--
+	close(h.wake)
+	h.wake = make(chan struct{})
+
+	h.results = append(h.results, ok)
+	if len(h.results) > resultWindow {
+		h.results = h.results[1:]
+	}
+
+	if !ok {
+		h.streak = 0
+		failed := 0
+		for _, r := range h.results {
+			if !r {
+				failed++
+			}
+		}
+		if len(h.results) >= minResults && float64(failed)/float64(len(h.results)) >= maxErrorRate && h.limit > 1 {
+			h.limit /= 2
+			h.results = nil
+			log.Printf("fetch: too many errors from %s so we allow %d requests at a time", h.name, h.limit)
+		}
+		return
+	}
+
+	h.streak++
+	if h.streak >= resultWindow && h.limit < h.max {
+		h.limit++
+		h.streak = 0
+		log.Printf("fetch: %s is doing well so we allow %d requests at a time", h.name, h.limit)
+	}
+}
+
+func (h *host) backoff(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if at := time.Now().Add(d); at.After(h.retryAt) {
+		h.retryAt = at
+	}
+}
+
+// slowDown to at most one request every d
+func (h *host) slowDown(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if limit := rate.Every(d); limit < h.limiter.Limit() {
+		h.limiter.SetLimit(limit)
+	}
+}
+
+func (h *host) setBandwidth(bytesPerSecond int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.bandwidth = newBandwidthLimiter(bytesPerSecond)
+}
+
+func (h *host) bandwidthLimiter() *rate.Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.bandwidth
+}
@@ -0,0 +1,229 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// network is the transport every request we make finally goes through
+// it is built from the proxy, no_proxy, ca_certs and headers options by Configure
+var network = struct {
+	sync.RWMutex
+	t       *http.Transport
+	headers map[string]string
+	// public key hashes of the extra certificates for chrome
+	spki []string
+}{t: http.DefaultTransport.(*http.Transport).Clone()}
+
+// Configure the network from the options
+// call it once the options are loaded
+func Configure() error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := proxyURL()
+	if err != nil {
+		return err
+	}
+	noProxy := options.GetStringSlice("no_proxy")
+	if proxy != nil {
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypass(req.URL.Host, noProxy) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+
+	var spki []string
+	if files := options.GetStringSlice("ca_certs"); len(files) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, fn := range files {
+			certs, err := readCerts(fn)
+			if err != nil {
+				return err
+			}
+			for _, c := range certs {
+				pool.AddCert(c)
+				sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+				spki = append(spki, base64.StdEncoding.EncodeToString(sum[:]))
+			}
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	headers := make(map[string]string)
+	if err := options.UnmarshalKey("headers", &headers); err != nil {
+		return fmt.Errorf("fetch.Configure: headers: %s", err)
+	}
+
+	network.Lock()
+	defer network.Unlock()
+
+	network.t = t
+	network.headers = headers
+	network.spki = spki
+
+	return nil
+}
+
+// Network is the transport we use for requests that do not need to be polite such as robots.txt
+// it sends our headers through our proxy and trusts our certificates
+var Network http.RoundTripper = networkTransport{}
+
+type networkTransport struct{}
+
+func (networkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	network.RLock()
+	t := network.t
+	headers := network.headers
+	network.RUnlock()
+
+	if len(headers) > 0 {
+		// a round tripper must not change the request it was given
+		req = req.Clone(req.Context())
+		for k, v := range headers {
+			if req.Header.Get(k) == "" {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+
+	return t.RoundTrip(req)
+}
+
+// Headers we send with every request
+func Headers() map[string]string {
+	network.RLock()
+	defer network.RUnlock()
+
+	headers := make(map[string]string, len(network.headers))
+	for k, v := range network.headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	return headers
+}
+
+// ChromeFlags so chrome uses the same proxy and trusts the same certificates as we do
+// chrome cannot be given certificates so we tell it to trust their public keys instead
+func ChromeFlags() map[string]string {
+	network.RLock()
+	defer network.RUnlock()
+
+	f := make(map[string]string)
+	if proxy := options.Get("proxy"); proxy != "" {
+		f["proxy-server"] = proxy
+		var bypassList []string
+		for _, h := range options.GetStringSlice("no_proxy") {
+			h = strings.TrimPrefix(strings.TrimPrefix(h, "*"), ".")
+			if h == "" {
+				continue
+			}
+			// chrome wants a pattern for the host and one for its subdomains
+			bypassList = append(bypassList, h)
+			if net.ParseIP(h) == nil && !strings.Contains(h, "/") {
+				bypassList = append(bypassList, "*."+h)
+			}
+		}
+		if len(bypassList) > 0 {
+			f["proxy-bypass-list"] = strings.Join(bypassList, ";")
+		}
+	}
+	if len(network.spki) > 0 {
+		f["ignore-certificate-errors-spki-list"] = strings.Join(network.spki, ",")
+	}
+	return f
+}
+
+// proxyURL from the proxy option
+// without it we use HTTPS_PROXY and friends like any other program
+func proxyURL() (*url.URL, error) {
+	proxy := options.Get("proxy")
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.Configure: proxy: %s", err)
+	}
+	return u, nil
+}
+
+// bypass is true if host is in no_proxy
+// an entry is a host and its subdomains, an ip, a cidr like 10.0.0.0/8 or * for every host
+func bypass(hostport string, noProxy []string) bool {
+	hostport = strings.ToLower(hostport)
+	host := hostport
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+
+	for _, e := range noProxy {
+		e = strings.ToLower(strings.TrimSpace(e))
+		switch {
+		case e == "":
+			continue
+		case e == "*":
+			return true
+		case e == hostport:
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(e); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		e = strings.TrimPrefix(strings.TrimPrefix(e, "*"), ".")
+		if host == e || strings.HasSuffix(host, "."+e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readCerts from a pem file
+func readCerts(fn string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("fetch.Configure: ca_certs: %s", err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("fetch.Configure: ca_certs: %s: %s", fn, err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("fetch.Configure: ca_certs: %s has no certificates", fn)
+	}
+
+	return certs, nil
+}
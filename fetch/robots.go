@@ -0,0 +1,252 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// robots rules for each host by scheme and host
+// the lock only guards the map so one slow host does not hold up the others
+var robotsCache = struct {
+	sync.Mutex
+	m map[string]*robotsEntry
+}{m: make(map[string]*robotsEntry)}
+
+// robotsEntry is fetched once for every request to its host
+// if we could not fetch it we try again after robotsRetry
+type robotsEntry struct {
+	sync.Mutex
+	done    bool
+	retryAt time.Time
+	r       *robots
+}
+
+// how long we wait for robots.txt
+const robotsTimeout = 30 * time.Second
+
+// how long we allow everything on a host whose robots.txt we could not fetch before we try again
+const robotsRetry = time.Minute
+
+// we fetch robots.txt with a plain client so we do not ask ourselves for permission
+var robotsClient = http.Client{
+	Transport: Network,
+}
+
+// robots are the rules from robots.txt that apply to us
+type robots struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// Allowed is false when robots.txt does not allow link
+// we allow everything if robots.txt cannot be found, respect_robots is off or we are offline
+func Allowed(ctx context.Context, link string) bool {
+	if Offline || !options.GetBool("respect_robots") {
+		return true
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return true
+	}
+
+	r := getRobots(u)
+	if r == nil {
+		return true
+	}
+
+	// rules may include the query like /search?q=
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return r.allows(path)
+}
+
+// getRobots for the host of u
+// robots.txt is fetched apart from the request that needs it
+// so a request that is cancelled does not leave its host without rules
+func getRobots(u *url.URL) *robots {
+	key := u.Scheme + "://" + u.Host
+
+	robotsCache.Lock()
+	e, ok := robotsCache.m[key]
+	if !ok {
+		e = &robotsEntry{}
+		robotsCache.m[key] = e
+	}
+	robotsCache.Unlock()
+
+	// requests to the same host wait here for the first one to fetch robots.txt
+	e.Lock()
+	defer e.Unlock()
+
+	if e.done || time.Now().Before(e.retryAt) {
+		return e.r
+	}
+
+	r, err := fetchRobots(key + "/robots.txt")
+	if err != nil {
+		log.Printf("fetch: robots.txt: %s", err)
+		e.retryAt = time.Now().Add(robotsRetry)
+		return nil
+	}
+	e.r = r
+	e.done = true
+
+	if r != nil && r.crawlDelay > 0 {
+		getHost(u.Hostname()).slowDown(r.crawlDelay)
+	}
+
+	return e.r
+}
+
+func fetchRobots(link string) (*robots, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), robotsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", options.Get("user_agent"))
+
+	res, err := robotsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		// the host may answer later
+		return nil, fmt.Errorf("%s: %s", link, res.Status)
+	}
+	if res.StatusCode != http.StatusOK {
+		// no robots.txt means no rules
+		return nil, nil
+	}
+
+	return parseRobots(io.LimitReader(res.Body, 500000)), nil
+}
+
+// parseRobots keeps the rules for every user agent
+// we are a browser as far as user agents go so we have no name of our own
+func parseRobots(r io.Reader) *robots {
+	var rules robots
+
+	// true while we are reading a group for every user agent
+	inGroup := false
+	// true once we have seen a rule in the current group
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+
+		switch k {
+		case "user-agent":
+			if inRules {
+				// a new group starts
+				inGroup = false
+				inRules = false
+			}
+			if v == "*" {
+				inGroup = true
+			}
+		case "allow":
+			inRules = true
+			if inGroup && v != "" {
+				rules.allow = append(rules.allow, v)
+			}
+		case "disallow":
+			inRules = true
+			if inGroup && v != "" {
+				rules.disallow = append(rules.disallow, v)
+			}
+		case "crawl-delay":
+			inRules = true
+			if inGroup {
+				if secs, err := strconv.ParseFloat(v, 64); err == nil {
+					rules.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	return &rules
+}
+
+// allows path if the longest matching rule allows it
+func (r *robots) allows(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	longest := 0
+	allowed := true
+	for _, p := range r.disallow {
+		if n := matchRobots(p, path); n > longest {
+			longest = n
+			allowed = false
+		}
+	}
+	for _, p := range r.allow {
+		if n := matchRobots(p, path); n >= longest && n > 0 {
+			longest = n
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+// matchRobots gives the length of pattern if it matches path or zero
+// patterns may use * for anything and end with $ to match the end of path
+func matchRobots(pattern string, path string) int {
+	anchored := strings.HasSuffix(pattern, "$")
+	p := strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(p, "*")
+	last := len(parts) - 1
+	rest := path
+	for i, part := range parts {
+		if i == last && anchored {
+			if !strings.HasSuffix(rest, part) || (i == 0 && rest != part) {
+				return 0
+			}
+			break
+		}
+		j := strings.Index(rest, part)
+		if j < 0 || (i == 0 && j != 0) {
+			return 0
+		}
+		rest = rest[j+len(part):]
+	}
+
+	return len(pattern)
+}
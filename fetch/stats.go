@@ -0,0 +1,210 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Label is the context key for who we are downloading for such as a member
+type Label struct{}
+
+// WithLabel counts downloads made with ctx under label
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, Label{}, label)
+}
+
+func labelOf(ctx context.Context) string {
+	label, _ := ctx.Value(Label{}).(string)
+	return label
+}
+
+// Transfer is how much we downloaded
+type Transfer struct {
+	Bytes int64
+	Start time.Time
+	Last  time.Time
+}
+
+// Throughput in bytes per second
+func (t Transfer) Throughput() float64 {
+	d := t.Last.Sub(t.Start).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / d
+}
+
+func (t *Transfer) add(n int, at time.Time) {
+	if t.Start.IsZero() {
+		t.Start = at
+	}
+	t.Last = at
+	t.Bytes += int64(n)
+}
+
+var stats = struct {
+	sync.Mutex
+	total  Transfer
+	hosts  map[string]*Transfer
+	labels map[string]*Transfer
+}{
+	hosts:  make(map[string]*Transfer),
+	labels: make(map[string]*Transfer),
+}
+
+// count n bytes we read from host
+func count(host string, label string, n int) {
+	now := time.Now()
+
+	stats.Lock()
+	defer stats.Unlock()
+
+	stats.total.add(n, now)
+
+	t, ok := stats.hosts[host]
+	if !ok {
+		t = &Transfer{}
+		stats.hosts[host] = t
+	}
+	t.add(n, now)
+
+	if label == "" {
+		return
+	}
+	t, ok = stats.labels[label]
+	if !ok {
+		t = &Transfer{}
+		stats.labels[label] = t
+	}
+	t.add(n, now)
+}
+
+// Total we downloaded so far
+func Total() Transfer {
+	stats.Lock()
+	defer stats.Unlock()
+
+	return stats.total
+}
+
+// ShowProgress prints how much we downloaded every so often until ctx is done
+// along with how fast we are downloading from each host and for each label right now
+func ShowProgress(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	var last int64
+	lastHosts := make(map[string]int64)
+	lastLabels := make(map[string]int64)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			total, hosts, labels := snapshot()
+			if total == last {
+				continue
+			}
+			rate := float64(total-last) / every.Seconds()
+			last = total
+
+			line := fmt.Sprintf("[progress] %s at %s/s", FormatBytes(float64(total)), FormatBytes(rate))
+			if r := rates(hosts, lastHosts, every); r != "" {
+				line += " | " + r
+			}
+			if r := rates(labels, lastLabels, every); r != "" {
+				line += " | " + r
+			}
+			lastHosts, lastLabels = hosts, labels
+			fmt.Println(line)
+		}
+	}
+}
+
+// snapshot of the bytes we downloaded in total, from each host and for each label
+func snapshot() (total int64, hosts map[string]int64, labels map[string]int64) {
+	stats.Lock()
+	defer stats.Unlock()
+
+	hosts = make(map[string]int64, len(stats.hosts))
+	for name, t := range stats.hosts {
+		hosts[name] = t.Bytes
+	}
+	labels = make(map[string]int64, len(stats.labels))
+	for name, t := range stats.labels {
+		labels[name] = t.Bytes
+	}
+	return stats.total.Bytes, hosts, labels
+}
+
+// rates of the names that downloaded something since last with the fastest first
+func rates(now map[string]int64, last map[string]int64, every time.Duration) string {
+	type rate struct {
+		name string
+		n    int64
+	}
+	var active []rate
+	for name, n := range now {
+		if d := n - last[name]; d > 0 {
+			active = append(active, rate{name, d})
+		}
+	}
+	sort.Slice(active, func(a, b int) bool {
+		if active[a].n != active[b].n {
+			return active[a].n > active[b].n
+		}
+		return active[a].name < active[b].name
+	})
+
+	var parts []string
+	for _, r := range active {
+		parts = append(parts, fmt.Sprintf("%s %s/s", r.name, FormatBytes(float64(r.n)/every.Seconds())))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PrintSummary of what we downloaded for each host and label
+func PrintSummary() {
+	stats.Lock()
+	defer stats.Unlock()
+
+	if stats.total.Bytes == 0 {
+		return
+	}
+
+	printTransfers := func(m map[string]*Transfer) {
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := m[name]
+			fmt.Printf("  %-32s %10s %10s/s\n", name, FormatBytes(float64(t.Bytes)), FormatBytes(t.Throughput()))
+		}
+	}
+
+	fmt.Printf("[transferred] %s at %s/s\n", FormatBytes(float64(stats.total.Bytes)), FormatBytes(stats.total.Throughput()))
+	if len(stats.labels) > 0 {
+		printTransfers(stats.labels)
+	}
+	printTransfers(stats.hosts)
+}
+
+// FormatBytes like 1.2 MB
+func FormatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
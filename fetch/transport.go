@@ -0,0 +1,95 @@
+package fetch
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// Transport is a polite http.RoundTripper
+// it also keeps to our bandwidth limits and counts what we download
+type Transport struct {
+	// Next does the actual request
+	Next http.RoundTripper
+}
+
+// NewTransport that makes polite requests with next
+// or through our network if next is nil
+func NewTransport(next http.RoundTripper) *Transport {
+	if next == nil {
+		next = Network
+	}
+	return &Transport{Next: next}
+}
+
+// RoundTrip waits for its turn with the host and retries when the host is busy
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	link := req.URL.String()
+
+	if !Allowed(ctx, link) {
+		return nil, fmt.Errorf("fetch: %s: %w", link, ErrDisallowed)
+	}
+
+	// we only retry requests we can safely send again
+	retries := 0
+	if req.Body == nil && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+		retries = options.GetInt("max_retries")
+	}
+
+	for attempt := 0; ; attempt++ {
+		release, err := Acquire(ctx, link)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.Next.RoundTrip(req)
+		if err != nil {
+			release(false)
+			return nil, err
+		}
+
+		if !IsBusy(res.StatusCode) {
+			release(res.StatusCode < 500)
+			res.Body = &meteredBody{
+				body:  res.Body,
+				ctx:   ctx,
+				host:  getHost(req.URL.Hostname()),
+				label: labelOf(ctx),
+			}
+			return res, nil
+		}
+
+		release(false)
+		Backoff(link, retryAfter(res.Header.Get("Retry-After")))
+		if attempt >= retries {
+			return res, nil
+		}
+
+		log.Printf("fetch: %s: %s so we try again", link, res.Status)
+		res.Body.Close()
+	}
+}
+
+// IsBusy is true when a status means the host wants us to slow down
+func IsBusy(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter parses a Retry-After header which is either seconds or a date
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -1,14 +1,16 @@
 module github.com/bobbytrapz/hinatazaka
 
 require (
-	github.com/bobbytrapz/gochrome v0.0.0-20220124134127-81b822428ffa
+	github.com/andybalholm/cascadia v1.3.1
 	github.com/go-rod/rod v0.114.8
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/spf13/afero v1.8.1 // indirect
 	github.com/spf13/cobra v1.3.0
 	github.com/spf13/viper v1.10.1
-	golang.org/x/sys v0.1.0 // indirect
+	golang.org/x/net v0.11.0
+	golang.org/x/text v0.14.0
+	golang.org/x/time v0.3.0
 	gopkg.in/ini.v1 v1.66.4 // indirect
 )
 
-go 1.13
+go 1.16
@@ -0,0 +1,36 @@
+// Package file writes files so a crash never leaves a partial file behind
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Write data to path by writing a temporary file next to it and renaming it
+// directories are made as needed and can be searched by whoever can read the file
+func Write(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, perm|(perm&0444)>>2); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,114 @@
+package members
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// Group of members we can name all at once
+type Group struct {
+	Name string `json:"name"`
+	// Generation is set for the generation groups we ship with such as gen1
+	Generation int      `json:"generation,omitempty"`
+	Members    []Member `json:"members"`
+}
+
+// groups by groupKey of their name
+var groups = map[string]Group{}
+
+// groupKey so a group is found however its name is typed
+// such as with full width letters or katakana for hiragana
+func groupKey(name string) string {
+	return foldKana(strings.ToLower(Canonical(name)))
+}
+
+// addGenerations makes a group for each generation in the roster
+func addGenerations() {
+	for _, m := range roster {
+		if m.Generation == 0 {
+			continue
+		}
+		name := fmt.Sprintf("gen%d", m.Generation)
+		g := groups[groupKey(name)]
+		g.Name = name
+		g.Generation = m.Generation
+		g.Members = append(g.Members, m)
+		groups[groupKey(name)] = g
+	}
+}
+
+// loadGroups from the config
+// the config looks like this and a group there replaces one we ship with
+//
+//	[groups]
+//	favorites = ["kyoko", "hinano"]
+func loadGroups() {
+	var custom map[string][]string
+	if err := options.UnmarshalKey("groups", &custom); err != nil {
+		fmt.Fprintln(os.Stderr, "members.loadGroups:", err)
+		return
+	}
+	for name, names := range custom {
+		g := Group{Name: strings.ToLower(name)}
+		for _, n := range names {
+			m, ok := Find(n)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "members.loadGroups: %s: We do not know who %q is\n", name, n)
+				continue
+			}
+			g.Members = append(g.Members, m)
+		}
+		groups[groupKey(name)] = g
+	}
+}
+
+// loadNicknames adds the nicknames from the config
+// a nickname there wins over one we ship with
+//
+//	[nicknames]
+//	kyoko = ["kyon"]
+func loadNicknames() {
+	var custom map[string][]string
+	if err := options.UnmarshalKey("nicknames", &custom); err != nil {
+		fmt.Fprintln(os.Stderr, "members.loadNicknames:", err)
+		return
+	}
+	for name, nicknames := range custom {
+		i, ok := keys[normalize(name)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "members.loadNicknames: We do not know who %q is\n", name)
+			continue
+		}
+		for _, n := range nicknames {
+			k := normalize(n)
+			if k == "" {
+				continue
+			}
+			roster[i].Nicknames = append(roster[i].Nicknames, n)
+			keys[k] = i
+			keyNames[k] = strings.ToLower(n)
+		}
+	}
+}
+
+// FindGroup by name such as gen1
+func FindGroup(name string) (Group, bool) {
+	g, ok := groups[groupKey(name)]
+	return g, ok
+}
+
+// Groups we know sorted by name
+func Groups() []Group {
+	var all []Group
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	sort.Slice(all, func(a, b int) bool {
+		return all[a].Name < all[b].Name
+	})
+	return all
+}
@@ -0,0 +1,54 @@
+package members
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+func TestFindGroup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "options.toml")
+	config := `[groups]
+"ＦＡＶ" = ["kyoko", "hinano"]
+"オシ" = ["kumi"]
+gen1 = ["kyoko"]
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := options.Load(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		members int
+	}{
+		{"fav", 2},
+		{"FAV", 2},
+		{"ｆａｖ", 2},
+		{"おし", 1},
+		{"オシ", 1},
+		{"ｵｼ", 1},
+		// a group in the config replaces one we ship with
+		{"gen1", 1},
+		{"ＧＥＮ２", 9},
+	}
+
+	for _, tt := range tests {
+		g, ok := FindGroup(tt.name)
+		if !ok || len(g.Members) != tt.members {
+			t.Errorf("FindGroup(%q) = %+v %v want %d members", tt.name, g, ok, tt.members)
+		}
+	}
+
+	if _, ok := FindGroup("nobody"); ok {
+		t.Errorf("FindGroup(%q) found a group", "nobody")
+	}
+}
@@ -0,0 +1,68 @@
+package members
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// StatusActive members are still in the group
+	StatusActive = "active"
+	// StatusGraduated members have left the group
+	StatusGraduated = "graduated"
+)
+
+// DateFormat of dates in a roster
+const DateFormat = "2006-01-02"
+
+// Member of hinatazaka46
+type Member struct {
+	// Name in kanji as the site writes it without spaces
+	Name string `json:"name"`
+	// Kana reading with a space between family and given name
+	Kana string `json:"kana,omitempty"`
+	// Romaji with family name first
+	Romaji     string `json:"romaji,omitempty"`
+	Generation int    `json:"generation,omitempty"`
+	Birthday   string `json:"birthday,omitempty"`
+	// CT is the id the site uses for the member
+	CT     int    `json:"ct"`
+	Blog   string `json:"blog,omitempty"`
+	Status string `json:"status,omitempty"`
+	// Graduated is the date the member graduated
+	Graduated string   `json:"graduated,omitempty"`
+	Nicknames []string `json:"nicknames,omitempty"`
+}
+
+// BlogURL of the member's blog list
+func (m Member) BlogURL() string {
+	if m.Blog != "" {
+		return m.Blog
+	}
+	return fmt.Sprintf(BlogListURL, m.CT)
+}
+
+// IsGraduated is true if the member left the group
+func (m Member) IsGraduated() bool {
+	return m.Status == StatusGraduated
+}
+
+// BirthdayTime is the member's birthday or the zero time if we do not know it
+func (m Member) BirthdayTime() time.Time {
+	t, _ := time.Parse(DateFormat, m.Birthday)
+	return t
+}
+
+// GraduatedTime is the day the member graduated or the zero time if we do not know it
+func (m Member) GraduatedTime() time.Time {
+	t, _ := time.Parse(DateFormat, m.Graduated)
+	return t
+}
+
+// String is the name along with romaji if we have it
+func (m Member) String() string {
+	if m.Romaji == "" {
+		return m.Name
+	}
+	return fmt.Sprintf("%s (%s)", m.Name, m.Romaji)
+}
@@ -1,153 +1,196 @@
 package members
 
 import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/bobbytrapz/hinatazaka/internal/file"
+	"github.com/bobbytrapz/hinatazaka/options"
 )
 
+// RosterFilename is the name of the roster in the config directory
+// members found there are added to the roster we ship with
+const RosterFilename = "members.json"
+
+// BlogListURL is the blog list of a member given their ct
+const BlogListURL = "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=%d"
+
+// the roster we ship with
+//
+//go:embed roster.json
+var defaultRoster []byte
+
 // Blogs maps names to blog list links
-// todo: update
-// they have not moved to hinatazaka46.com yet
-var Blogs = map[string]string{
-	"井口眞緒":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=1",
-	"潮紗理菜":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=2",
-	"柿崎芽実":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=3",
-	"影山優佳":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=4",
-	"加藤史帆":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=5",
-	"齊藤京子":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=6",
-	"佐々木久美":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=7",
-	"佐々木美玲":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=8",
-	"高瀬愛奈":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=9",
-	"高本彩花":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=10",
-	"東村芽依":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=11",
-	"金村美玖":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=12",
-	"河田陽菜":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=13",
-	"小坂菜緒":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=14",
-	"富田鈴花":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=15",
-	"丹生明里":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=16",
-	"濱岸ひより":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=17",
-	"松田好花":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=18",
-	"宮田愛萌":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=19",
-	"渡邉美穂":      "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=20",
-	"上村ひなの":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=21",
-	"髙橋未来虹":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=22",
-	"森本茉莉":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=23",
-	"山口陽世":     "https://www.hinatazaka46.com/s/official/diary/member/list?ima=0000&ct=24",
+var Blogs = map[string]string{}
+
+// roster of every member we know in order
+var roster []Member
+
+func init() {
+	shipped, err := parseRoster(defaultRoster)
+	if err != nil {
+		panic(err)
+	}
+	load(shipped)
+}
+
+// Load the roster we ship with along with the members, nicknames and groups from the config
+// options must be loaded first
+func Load() error {
+	shipped, err := parseRoster(defaultRoster)
+	if err != nil {
+		return err
+	}
+
+	override, err := ReadRoster(RosterPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("members.Load: %w", err)
+	}
+
+	load(MergeRoster(shipped, override))
+	loadNicknames()
+	loadGroups()
+
+	return nil
+}
+
+// RosterPath is where we keep the roster that overrides the one we ship with
+func RosterPath() string {
+	return filepath.Join(options.ConfigPath, RosterFilename)
+}
+
+// ReadRoster from a file
+func ReadRoster(path string) ([]Member, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roster, err := parseRoster(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return roster, nil
+}
+
+// WriteRoster to a file
+func WriteRoster(path string, roster []Member) error {
+	data, err := json.MarshalIndent(roster, "", "\t")
+	if err != nil {
+		return err
+	}
+	return file.Write(path, append(data, '\n'), 0644)
+}
+
+func parseRoster(data []byte) ([]Member, error) {
+	var roster []Member
+	if err := json.Unmarshal(data, &roster); err != nil {
+		return nil, err
+	}
+	for i, m := range roster {
+		if m.Name == "" {
+			return nil, fmt.Errorf("member %d has no name", i+1)
+		}
+	}
+	return roster, nil
+}
+
+// MergeRoster adds override to roster
+// members are matched by name even if it is written with variant kanji or spaces
+// and the override wins except nicknames are kept from both
+// a member keeps the name they had since it names their archive
+func MergeRoster(roster []Member, override []Member) []Member {
+	merged := append([]Member{}, roster...)
+
+	index := make(map[string]int)
+	for i, e := range merged {
+		index[Canonical(e.Name)] = i
+	}
+
+	for _, o := range override {
+		key := Canonical(o.Name)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, o)
+			continue
+		}
+		e := &merged[i]
+		if o.Kana != "" {
+			e.Kana = o.Kana
+		}
+		if o.Romaji != "" {
+			e.Romaji = o.Romaji
+		}
+		if o.Generation != 0 {
+			e.Generation = o.Generation
+		}
+		if o.Birthday != "" {
+			e.Birthday = o.Birthday
+		}
+		if o.CT != 0 {
+			e.CT = o.CT
+		}
+		if o.Blog != "" {
+			e.Blog = o.Blog
+		}
+		if o.Status != "" {
+			e.Status = o.Status
+		}
+		if o.Status == StatusActive {
+			// an active member has no graduation
+			e.Graduated = ""
+		}
+		if o.Graduated != "" {
+			e.Graduated = o.Graduated
+		}
+		if len(o.Nicknames) > 0 {
+			e.Nicknames = append(append([]string{}, e.Nicknames...), o.Nicknames...)
+		}
+	}
+
+	return merged
+}
+
+// load a roster into Blogs and the names we resolve
+func load(members []Member) {
+	roster = members
+	Blogs = make(map[string]string)
+	keys = make(map[string]int)
+	keyNames = make(map[string]string)
+	groups = make(map[string]Group)
+	for i, m := range roster {
+		if m.Status == "" {
+			roster[i].Status = StatusActive
+		}
+		Blogs[m.Name] = m.BlogURL()
+		addKeys(i)
+	}
+	addGenerations()
+}
+
+// All members we know in roster order
+func All() []Member {
+	return append([]Member{}, roster...)
 }
 
-// nicknames of members
-var nicknames = map[string]string{
-	"iguchi": "井口眞緒",
-	"mao":    "井口眞緒",
-	"mama":   "井口眞緒",
-	"bau":    "井口眞緒",
-	"ママ":     "井口眞緒",
-	"ばう":     "井口眞緒",
-
-	"ushio":  "潮紗理菜",
-	"sarina": "潮紗理菜",
-
-	"kakizaki": "柿崎芽実",
-	"memi":     "柿崎芽実",
-
-	"kageyama": "影山優佳",
-	"yuuka":    "影山優佳",
-	"kage":     "影山優佳",
-	"kagechan": "影山優佳",
-	"影ちゃん":     "影山優佳",
-
-	"kato":    "加藤史帆",
-	"shiho":   "加藤史帆",
-	"katoshi": "加藤史帆",
-	"toshi":   "加藤史帆",
-
-	"きょんこ":        "齊藤京子",
-	"キョンこ":        "齊藤京子",
-	"さいきょー":       "齊藤京子",
-	"ラーメン":        "齊藤京子",
-	"saito kyoko": "齊藤京子",
-	"kyoko":       "齊藤京子",
-	"kyonko":      "齊藤京子",
-	"saikyo":      "齊藤京子",
-	"ramen":       "齊藤京子",
-
-	"kumi":    "佐々木久美",
-	"captain": "佐々木久美",
-
-	"mirei":  "佐々木美玲",
-	"miipan": "佐々木美玲",
-
-	"takase": "高瀬愛奈",
-	"mana":   "高瀬愛奈",
-	"manafi": "高瀬愛奈",
-
-	"takamoto": "高本彩花",
-	"ayaka":    "高本彩花",
-	"otake":    "高本彩花",
-	"おたけ":      "高本彩花",
-
-	"higashimura": "東村芽依",
-	"mei":         "東村芽依",
-	"meimei":      "東村芽依",
-
-	"kanemura": "金村美玖",
-	"miku":     "金村美玖",
-	"sushi":    "金村美玖",
-
-	"kawata": "河田陽菜",
-	"hina":   "河田陽菜",
-
-	"kosaka": "小坂菜緒",
-	"nao":    "小坂菜緒",
-
-	"tomita": "富田鈴花",
-	"suzuka": "富田鈴花",
-	"paripi": "富田鈴花",
-	"パリピ":    "富田鈴花",
-
-	"nibu":  "丹生明里",
-	"akari": "丹生明里",
-
-	"hamagishi": "濱岸ひより",
-	"hiyori":    "濱岸ひより",
-	"hiyotan":   "濱岸ひより",
-	"ひよたん":      "濱岸ひより",
-
-	"matsuda": "松田好花",
-	"konoka":  "松田好花",
-
-	"miyata": "宮田愛萌",
-	"manamo": "宮田愛萌",
-
-	"watanabe": "渡邉美穂",
-	"miho":     "渡邉美穂",
-	"bemiho":   "渡邉美穂",
-
-	"kamimura":   "上村ひなの",
-	"hinano":     "上村ひなの",
-	"hinanonano": "上村ひなの",
-	"nano":       "上村ひなの",
-	"ひなの":        "上村ひなの",
-
-	"takahashi": "髙橋未来虹",
-	"mikuni": "髙橋未来虹",
-
-	"morimoto": "森本茉莉",
-	"marii": "森本茉莉",
-
-	"yamaguchi": "山口陽世",
-	"haruyo": "山口陽世",
-	"paru": "山口陽世",
-	"paruyo": "山口陽世",
+// Find a member by name, nickname, kana reading or romaji
+func Find(name string) (Member, bool) {
+	m, _, ok := Resolve(name)
+	return m, ok
 }
 
 // RealName provides the real name of a member
 func RealName(name string) string {
-	name = strings.ToLower(name)
-	if realname, ok := nicknames[name]; ok {
+	if m, _, ok := Resolve(name); ok {
 		// name is a nickname so use real name
-		return realname
+		return m.Name
 	}
-	return name
+	return strings.ToLower(Canonical(name))
 }
 
 // BlogURL of a member by name or nickname
@@ -0,0 +1,47 @@
+package members
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRoster(t *testing.T) {
+	roster := []Member{
+		{Name: "齊藤京子", CT: 6, Status: StatusActive, Nicknames: []string{"kyoko"}},
+		{Name: "渡邉美穂", CT: 20, Status: StatusActive},
+	}
+	// the site may write a name with variant kanji or a space
+	override := []Member{
+		{Name: "斉藤京子", Status: StatusGraduated, Nicknames: []string{"kyonko"}},
+		{Name: "渡辺 美穂", Kana: "わたなべ みほ"},
+		{Name: "渡辺莉奈", CT: 36},
+	}
+
+	got := MergeRoster(roster, override)
+	want := []Member{
+		{Name: "齊藤京子", CT: 6, Status: StatusGraduated, Nicknames: []string{"kyoko", "kyonko"}},
+		{Name: "渡邉美穂", Kana: "わたなべ みほ", CT: 20, Status: StatusActive},
+		{Name: "渡辺莉奈", CT: 36},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeRoster() = %#v\nwant %#v", got, want)
+	}
+}
+
+func TestMergeRosterActive(t *testing.T) {
+	roster := []Member{
+		{Name: "加藤史帆", CT: 5, Status: StatusGraduated, Graduated: "2024-12-01"},
+	}
+	// a member who is on the site again is active
+	override := []Member{
+		{Name: "加藤史帆", CT: 5, Status: StatusActive},
+	}
+
+	got := MergeRoster(roster, override)
+	want := []Member{
+		{Name: "加藤史帆", CT: 5, Status: StatusActive},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeRoster() = %#v\nwant %#v", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package members
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinConfidence of a match we suggest
+const MinConfidence = 0.5
+
+// Match of a name to a member
+type Match struct {
+	Member Member
+	// Key is what we matched such as a nickname or romaji
+	Key string
+	// Confidence is 1 for an exact match and less the more we had to change
+	Confidence float64
+}
+
+// every way to write each member's name by normalized key
+// the value is the index of the member in roster
+var keys = map[string]int{}
+
+// how a key was written before we normalized it
+var keyNames = map[string]string{}
+
+// addKeys for the member at index i of roster
+func addKeys(i int) {
+	m := roster[i]
+
+	names := []string{m.Name, m.Kana, m.Romaji}
+	names = append(names, m.Nicknames...)
+
+	// romaji of the kana reading with the family name first and last
+	if parts := strings.Fields(m.Kana); len(parts) > 0 {
+		orders := []string{strings.Join(parts, " ")}
+		if len(parts) == 2 {
+			orders = append(orders, parts[1]+" "+parts[0])
+		}
+		for _, kana := range orders {
+			h := Hepburn(kana)
+			names = append(names, h, withoutLongVowels(h), Kunrei(h), withoutLongVowels(Kunrei(h)))
+		}
+	}
+
+	for _, n := range names {
+		k := normalize(n)
+		if k == "" {
+			continue
+		}
+		if _, ok := keys[k]; ok {
+			// the first member to use a name keeps it
+			continue
+		}
+		keys[k] = i
+		keyNames[k] = strings.ToLower(n)
+	}
+}
+
+// normalize a name so different ways of typing it are the same
+func normalize(name string) string {
+	name = foldKana(strings.ToLower(Canonical(name)))
+
+	var b strings.Builder
+	for _, r := range name {
+		if r == '-' || r == '\'' || r == '・' || r == '.' {
+			continue
+		}
+		if v, ok := macrons[r]; ok {
+			b.WriteString(v)
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// long vowels written with a macron or circumflex
+var macrons = map[rune]string{
+	'ā': "a", 'ī': "i", 'ū': "u", 'ē': "e", 'ō': "o",
+	'â': "a", 'î': "i", 'û': "u", 'ê': "e", 'ô': "o",
+}
+
+// Resolve a name, nickname, kana reading or romaji to a member
+// ok is only true for an exact match otherwise we give the closest member we found
+func Resolve(name string) (member Member, confidence float64, ok bool) {
+	if i, found := keys[normalize(name)]; found {
+		return roster[i], 1, true
+	}
+
+	matches := Suggest(name, 1)
+	if len(matches) == 0 {
+		return Member{}, 0, false
+	}
+	return matches[0].Member, matches[0].Confidence, false
+}
+
+// Suggest up to n members whose names are close to name with the closest first
+func Suggest(name string, n int) []Match {
+	k := normalize(name)
+	if k == "" {
+		return nil
+	}
+
+	best := make(map[int]Match)
+	for key, i := range keys {
+		d := distance(k, key)
+		longest := utf8.RuneCountInString(k)
+		if l := utf8.RuneCountInString(key); l > longest {
+			longest = l
+		}
+		confidence := 1 - float64(d)/float64(longest)
+		if confidence < MinConfidence {
+			continue
+		}
+		if m, ok := best[i]; ok && (m.Confidence > confidence || (m.Confidence == confidence && m.Key < keyNames[key])) {
+			continue
+		}
+		best[i] = Match{
+			Member:     roster[i],
+			Key:        keyNames[key],
+			Confidence: confidence,
+		}
+	}
+
+	var matches []Match
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Confidence != matches[b].Confidence {
+			return matches[a].Confidence > matches[b].Confidence
+		}
+		return matches[a].Member.CT < matches[b].Member.CT
+	})
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+
+	return matches
+}
+
+// distance is the levenshtein distance between a and b in runes
+func distance(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := prev[j-1] + cost; v < cur[j] {
+				cur[j] = v
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
@@ -0,0 +1,97 @@
+package members
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		// names and nicknames
+		{"齊藤京子", "齊藤京子"},
+		{"kyoko", "齊藤京子"},
+		{"KYOKO", "齊藤京子"},
+		{"ラーメン", "齊藤京子"},
+		// kana readings with or without a space
+		{"さいとう きょうこ", "齊藤京子"},
+		{"さいとうきょうこ", "齊藤京子"},
+		// hepburn as it is typed or written
+		{"saitou kyouko", "齊藤京子"},
+		{"Saito Kyoko", "齊藤京子"},
+		{"kyouko saitou", "齊藤京子"},
+		{"Saitō Kyōko", "齊藤京子"},
+		{"shougenji youko", "正源司陽子"},
+		{"shogenji yoko", "正源司陽子"},
+		{"fujishima kaho", "藤嶌果歩"},
+		// kunrei
+		{"katou siho", "加藤史帆"},
+		{"syougenzi youko", "正源司陽子"},
+		{"syogenzi yoko", "正源司陽子"},
+		{"huzisima kaho", "藤嶌果歩"},
+		{"simizu rio", "清水理央"},
+	}
+
+	for _, tt := range tests {
+		m, confidence, ok := Resolve(tt.name)
+		if !ok || m.Name != tt.want || confidence != 1 {
+			t.Errorf("Resolve(%q) = %s %v %v want %s", tt.name, m.Name, confidence, ok, tt.want)
+		}
+	}
+}
+
+func TestResolveClose(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"kyokko", "齊藤京子"},
+		{"saito kyouk", "齊藤京子"},
+		{"kamimura hinan", "上村ひなの"},
+		{"sasaki mire", "佐々木美玲"},
+	}
+
+	for _, tt := range tests {
+		m, confidence, ok := Resolve(tt.name)
+		if ok || m.Name != tt.want || confidence >= 1 || confidence < MinConfidence {
+			t.Errorf("Resolve(%q) = %s %v %v want a close match to %s", tt.name, m.Name, confidence, ok, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	// the closest member comes first
+	got := Suggest("sasaki mi", 2)
+	if len(got) != 2 || got[0].Member.Name != "佐々木久美" || got[1].Member.Name != "佐々木美玲" {
+		t.Errorf("Suggest(%q) = %+v want both Sasaki", "sasaki mi", got)
+	}
+
+	if got := Suggest("zzzzzzzz", 3); len(got) != 0 {
+		t.Errorf("Suggest(%q) = %+v want nothing", "zzzzzzzz", got)
+	}
+	if got := Suggest("", 3); len(got) != 0 {
+		t.Errorf("Suggest(%q) = %+v want nothing", "", got)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"kitten", "sitting", 3},
+		{"kyoko", "kyouko", 1},
+		// runes not bytes
+		{"京子", "京", 1},
+		{"きょうこ", "きょこ", 1},
+	}
+
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package members
+
+import (
+	"strings"
+)
+
+// hepburn romaji of each hiragana
+var hepburn = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゔ': "vu",
+}
+
+// small kana that join the kana before them like きょ
+var smallY = map[rune]string{
+	'ゃ': "a", 'ゅ': "u", 'ょ': "o",
+}
+
+// kunrei spelling of hepburn spellings in the order we replace them
+var kunrei = []string{
+	"tchi", "tti",
+	"tch", "tty",
+	"shi", "si",
+	"sh", "sy",
+	"chi", "ti",
+	"ch", "ty",
+	"tsu", "tu",
+	"fu", "hu",
+	"ji", "zi",
+	"j", "zy",
+}
+
+// Hepburn romaji of hiragana as it is typed such as saitou kyouko
+// anything that is not hiragana is kept as it is
+func Hepburn(kana string) string {
+	var b strings.Builder
+
+	runes := []rune(kana)
+	double := false
+	// the vowel of the last syllable we wrote or 0 if it was not one of ours
+	var vowel rune
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch r {
+		case 'っ':
+			// the next consonant is doubled
+			double = true
+			continue
+		case 'ー':
+			// repeat the last vowel
+			if vowel != 0 {
+				b.WriteRune(vowel)
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+
+		syllable, ok := hepburn[r]
+		if !ok {
+			b.WriteRune(r)
+			double = false
+			vowel = 0
+			continue
+		}
+
+		// join きょ and friends
+		if i+1 < len(runes) {
+			if v, ok := smallY[runes[i+1]]; ok && strings.HasSuffix(syllable, "i") {
+				stem := syllable[:len(syllable)-1]
+				switch syllable {
+				case "shi", "chi", "ji":
+				default:
+					stem += "y"
+				}
+				syllable = stem + v
+				i++
+			}
+		}
+
+		if double {
+			if strings.HasPrefix(syllable, "ch") {
+				b.WriteByte('t')
+			} else {
+				b.WriteByte(syllable[0])
+			}
+			double = false
+		}
+		b.WriteString(syllable)
+
+		vowel = 0
+		if last := rune(syllable[len(syllable)-1]); strings.ContainsRune("aiueo", last) {
+			vowel = last
+		}
+	}
+
+	return b.String()
+}
+
+// Kunrei romaji from hepburn romaji such as saitou kyouko
+func Kunrei(romaji string) string {
+	// the replacer tries shi before sh since it comes first
+	return strings.NewReplacer(kunrei...).Replace(romaji)
+}
+
+// withoutLongVowels the way romaji is usually written such as saito kyoko
+func withoutLongVowels(romaji string) string {
+	return strings.NewReplacer("ou", "o", "oo", "o", "uu", "u").Replace(romaji)
+}
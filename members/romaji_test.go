@@ -0,0 +1,81 @@
+package members
+
+import "testing"
+
+func TestHepburn(t *testing.T) {
+	tests := []struct {
+		kana string
+		want string
+	}{
+		{"さいとう きょうこ", "saitou kyouko"},
+		{"かとう しほ", "katou shiho"},
+		{"かみむら ひなの", "kamimura hinano"},
+		{"しゃしん", "shashin"},
+		{"ちょこ", "choko"},
+		{"じゅん", "jun"},
+		{"りょう", "ryou"},
+		// っ doubles the next consonant
+		{"はっとり", "hattori"},
+		{"きっさ", "kissa"},
+		{"まっちゃ", "matcha"},
+		{"こっち", "kotchi"},
+		// ー repeats the vowel before it
+		{"らーめん", "raamen"},
+		{"きょーこ", "kyooko"},
+		{"ちー", "chii"},
+		// anything else is kept as it is
+		{"京ー", "京ー"},
+		{"キョーコ", "キョーコ"},
+		{"ー", "ー"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Hepburn(tt.kana); got != tt.want {
+			t.Errorf("Hepburn(%q) = %q want %q", tt.kana, got, tt.want)
+		}
+	}
+}
+
+func TestKunrei(t *testing.T) {
+	tests := []struct {
+		hepburn string
+		want    string
+	}{
+		{"shiho", "siho"},
+		{"shashin", "syasin"},
+		{"chiharu", "tiharu"},
+		{"choko", "tyoko"},
+		{"matcha", "mattya"},
+		{"botchan", "bottyan"},
+		{"kotchi", "kotti"},
+		{"tsubasa", "tubasa"},
+		{"fujita", "huzita"},
+		{"jun", "zyun"},
+		{"saitou kyouko", "saitou kyouko"},
+	}
+
+	for _, tt := range tests {
+		if got := Kunrei(tt.hepburn); got != tt.want {
+			t.Errorf("Kunrei(%q) = %q want %q", tt.hepburn, got, tt.want)
+		}
+	}
+}
+
+func TestWithoutLongVowels(t *testing.T) {
+	tests := []struct {
+		romaji string
+		want   string
+	}{
+		{"saitou kyouko", "saito kyoko"},
+		{"oono", "ono"},
+		{"yuuka", "yuka"},
+		{"hinano", "hinano"},
+	}
+
+	for _, tt := range tests {
+		if got := withoutLongVowels(tt.romaji); got != tt.want {
+			t.Errorf("withoutLongVowels(%q) = %q want %q", tt.romaji, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package members
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// ArtistListURL lists every member on the official site
+const ArtistListURL = "https://www.hinatazaka46.com/s/official/search/artist?ima=0000"
+
+// the artist page of a member ends with their ct
+var artistCT = regexp.MustCompile(`/artist/(\d+)`)
+
+// each member on the artist list
+// the page lists each member more than once in different orders
+var (
+	memberItem = cascadia.MustCompile(".p-member__item")
+	memberLink = cascadia.MustCompile("a[href]")
+	memberName = cascadia.MustCompile(".c-member__name")
+	memberKana = cascadia.MustCompile(".c-member__kana")
+)
+
+// Discover members listed on a page like ArtistListURL
+func Discover(r io.Reader) ([]Member, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roster []Member
+	seen := make(map[int]bool)
+	for _, el := range cascadia.QueryAll(doc, memberItem) {
+		a := cascadia.Query(el, memberLink)
+		if a == nil {
+			continue
+		}
+		m := artistCT.FindStringSubmatch(attr(a, "href"))
+		name := text(cascadia.Query(el, memberName))
+		if m == nil || name == "" {
+			continue
+		}
+		ct, err := strconv.Atoi(m[1])
+		if err != nil || seen[ct] {
+			continue
+		}
+		seen[ct] = true
+
+		roster = append(roster, Member{
+			// the site puts a space between names
+			Name: strings.Join(strings.Fields(name), ""),
+			Kana: strings.Join(strings.Fields(text(cascadia.Query(el, memberKana))), " "),
+			CT:   ct,
+		})
+	}
+
+	return roster, nil
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// text in a node and every node under it
+func text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,41 @@
+package members
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	f, err := os.Open("testdata/artist_list.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := Discover(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Member{
+		{Name: "加藤史帆", Kana: "かとう しほ", CT: 5},
+		{Name: "齊藤京子", Kana: "さいとう きょうこ", CT: 6},
+		{Name: "上村ひなの", Kana: "かみむら ひなの", CT: 21},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDiscoverNothing(t *testing.T) {
+	// a page that is not the member list has no members
+	got, err := Discover(strings.NewReader("<html><body><p>メンテナンス中</p></body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Discover() = %+v want nothing", got)
+	}
+}
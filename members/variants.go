@@ -0,0 +1,49 @@
+package members
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// itaiji are variant kanji the site or people use for the same name
+// each one maps to the form we compare with
+var itaiji = map[rune]rune{
+	'髙': '高', '﨑': '崎', '嵜': '崎', '邉': '辺', '邊': '辺',
+	'齊': '斉', '齋': '斉', '斎': '斉', '濱': '浜', '濵': '浜', '澤': '沢',
+	'嶋': '島', '嶌': '島', '眞': '真', '櫻': '桜', '廣': '広',
+	'國': '国', '榮': '栄', '惠': '恵', '壽': '寿', '實': '実',
+	'彌': '弥', '龍': '竜', '瀨': '瀬', '德': '徳', '曉': '暁',
+	'藏': '蔵', '絲': '糸', '兒': '児', '條': '条', '淺': '浅',
+	'禮': '礼', '豐': '豊', '將': '将', '萬': '万', '驒': '騨',
+}
+
+// Canonical form of a name as the site or a user may write it
+// it is NFKC normalized, variant kanji are replaced and spaces are removed
+func Canonical(name string) string {
+	name = norm.NFKC.String(name)
+
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		if v, ok := itaiji[r]; ok {
+			r = v
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// foldKana so katakana and hiragana are the same
+func foldKana(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'ァ' && r <= 'ヶ' {
+			return r - 'ァ' + 'ぁ'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,81 @@
+package members
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		// spaces of any width are removed
+		{"齊藤 京子", "斉藤京子"},
+		{"齊藤　京子", "斉藤京子"},
+		// full width letters and digits are nfkc normalized
+		{"ｋｙｏｋｏ", "kyoko"},
+		{"ＧＥＮ２", "GEN2"},
+		// half width katakana
+		{"ｷｮｳｺ", "キョウコ"},
+		// every way to write sai in saito is the same
+		{"齊藤", "斉藤"},
+		{"齋藤", "斉藤"},
+		{"斎藤", "斉藤"},
+		{"斉藤", "斉藤"},
+		{"髙橋未来虹", "高橋未来虹"},
+		{"渡邉美穂", "渡辺美穂"},
+		{"濱岸ひより", "浜岸ひより"},
+		{"藤嶌果歩", "藤島果歩"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Canonical(tt.name); got != tt.want {
+			t.Errorf("Canonical(%q) = %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFoldKana(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"キョウコ", "きょうこ"},
+		{"ヒナノ", "ひなの"},
+		{"ヴ", "ゔ"},
+		{"京子", "京子"},
+		{"kyoko", "kyoko"},
+	}
+
+	for _, tt := range tests {
+		if got := foldKana(tt.name); got != tt.want {
+			t.Errorf("foldKana(%q) = %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"斉藤京子", "齊藤京子"},
+		{"斎藤京子", "齊藤京子"},
+		{"齋藤 京子", "齊藤京子"},
+		{"サイトウキョウコ", "齊藤京子"},
+		{"ｻｲﾄｳ ｷｮｳｺ", "齊藤京子"},
+		{"ｋｙｏｋｏ", "齊藤京子"},
+		{"ＫＹＯＫＯ", "齊藤京子"},
+		{"高橋未来虹", "髙橋未来虹"},
+		{"渡辺美穂", "渡邉美穂"},
+		{"浜岸ひより", "濱岸ひより"},
+		{"藤島果歩", "藤嶌果歩"},
+		{"カミムラ　ヒナノ", "上村ひなの"},
+	}
+
+	for _, tt := range tests {
+		m, ok := Find(tt.name)
+		if !ok || m.Name != tt.want {
+			t.Errorf("Find(%q) = %s %v want %s", tt.name, m.Name, ok, tt.want)
+		}
+	}
+}
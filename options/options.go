@@ -1,11 +1,13 @@
 package options
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -28,6 +30,46 @@ func GetInt(k string) int {
 	return v.GetInt(k)
 }
 
+// GetBool option
+func GetBool(k string) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.GetBool(k)
+}
+
+// GetFloat64 option
+func GetFloat64(k string) float64 {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.GetFloat64(k)
+}
+
+// GetDuration option
+func GetDuration(k string) time.Duration {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.GetDuration(k)
+}
+
+// UnmarshalKey decodes an option into out
+func UnmarshalKey(k string, out interface{}) error {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.UnmarshalKey(k, out)
+}
+
+// GetStringSlice option
+func GetStringSlice(k string) []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.GetStringSlice(k)
+}
+
 const (
 	// Filename for config file
 	Filename = "options"
@@ -38,55 +80,144 @@ const (
 	configPathUnix    = ".config/hinatazaka/"
 	defaultUserAgent  = `Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/71.0.3578.98 Safari/537.36`
 	defaultChromePort = 32719
+	// requests per second to each host
+	defaultRateLimit = 2.0
+	defaultRateBurst = 5
+	// requests in flight to each host
+	defaultHostConcurrency = 8
+	defaultMaxRetries      = 3
+	// time we wait for the network
+	defaultHTTPTimeout     = 1 * time.Minute
+	defaultBlogListTimeout = 1 * time.Minute
+	defaultBlogTimeout     = 1 * time.Minute
+	defaultSpiderTimeout   = 1 * time.Minute
+	defaultPageTimeout     = 10 * time.Second
+	// pages and tabs we open in chrome at once
+	defaultPages = 8
+	defaultTabs  = 8
+	// links we save images from at once
+	defaultJobs = 4
+	// pages of a gallery we follow
+	defaultGalleryPages = 20
 )
 
+// requests we do not need when archiving a blog
+var defaultBlockURLs = []string{
+	"*google-analytics.com*",
+	"*googletagmanager.com*",
+	"*googlesyndication.com*",
+	"*doubleclick.net*",
+	"*adservice.google.*",
+	"*connect.facebook.net*",
+	"*platform.twitter.com*",
+	"*fonts.googleapis.com*",
+	"*fonts.gstatic.com*",
+}
+
+// resource types we do not need when archiving a blog
+var defaultBlockResourceTypes = []string{
+	"Font",
+	"Media",
+	"Ping",
+}
+
 // ConfigPath is the path where track list and config file are kept
 var ConfigPath string
 
+// Profile we loaded or empty if we only use the options at the top of the config
+var Profile string
+
+// EnvPrefix of environment variables that replace options such as HINATAZAKA_SAVE_TO
+const EnvPrefix = "HINATAZAKA"
+
 var v = viper.New()
 
+// configFile we loaded and save to
+var configFile string
+
+// loadErr is why we could not read the config file
+var loadErr error
+
 func init() {
+	// set defaults
+	for _, k := range Schema {
+		if k.Default != nil {
+			setDefault(k.Name, k.Default)
+		}
+	}
+}
+
+// DefaultConfigPath is where we keep the config unless we are given another one
+func DefaultConfigPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Println("options.init:", err)
-		os.Exit(1)
+		return "", fmt.Errorf("options.DefaultConfigPath: %w", err)
 	}
-
-	// set defaults
-	v.SetDefault("user_agent", defaultUserAgent)
-	v.SetDefault("chrome_port", defaultChromePort)
-
-	v.SetConfigType(Format)
-	v.SetConfigName(Filename)
-
-	var configPath string
 	if runtime.GOOS == "windows" {
-		configPath = filepath.Join(home, configPathWindows)
-	} else {
-		configPath = filepath.Join(home, configPathUnix)
+		return filepath.Join(home, configPathWindows), nil
 	}
+	return filepath.Join(home, configPathUnix), nil
+}
+
+// Load options from the config file at path or from the default config file if path is empty
+// options in a profile such as [profiles.nas] replace the ones at the top of the config
+// and environment variables such as HINATAZAKA_SAVE_TO replace them both
+// nothing is written so it is fine if there is no config file
+func Load(path string, profile string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	home, err := os.UserHomeDir()
 	if err != nil {
-		fmt.Println("options.init:", err)
-		os.Exit(1)
+		return fmt.Errorf("options.Load: %w", err)
 	}
 
-	savePath := filepath.Join(home, defaultSavePath)
+	if path == "" {
+		dir, err := DefaultConfigPath()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, Filename+"."+Format)
+	}
+	configFile = path
+	ConfigPath = filepath.Dir(path)
+	Profile = profile
 
-	ConfigPath = configPath
+	setDefault("save_to", filepath.Join(home, defaultSavePath))
+	setDefault("cache_dir", filepath.Join(ConfigPath, "cache"))
 
-	if err := os.MkdirAll(ConfigPath, 0700); err != nil {
-		fmt.Println("error:", err)
-		return
-	}
+	v.SetConfigFile(path)
+	v.SetConfigType(Format)
+	v.SetEnvPrefix(EnvPrefix)
+	v.AutomaticEnv()
 
-	v.SetDefault("save_to", savePath)
-	v.AddConfigPath(configPath)
+	loadErr = nil
+	if err := v.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		loadErr = fmt.Errorf("%s: %w", path, err)
+		return loadErr
+	}
 
-	if err := v.ReadInConfig(); err != nil {
-		p := filepath.Join(configPath, Filename+"."+Format)
-		if err := v.WriteConfigAs(p); err != nil {
-			panic(err)
+	if profile != "" {
+		p := v.Sub("profiles." + profile)
+		if p == nil {
+			loadErr = fmt.Errorf("There is no profile %q in %s", profile, path)
+			return loadErr
+		}
+		if err := v.MergeConfigMap(p.AllSettings()); err != nil {
+			loadErr = fmt.Errorf("profiles.%s: %w", profile, err)
+			return loadErr
 		}
-		fmt.Println("[ok] wrote new config file")
 	}
+
+	return nil
+}
+
+// ConfigFile is the path of the config file
+func ConfigFile() string {
+	return configFile
+}
+
+// Reload the config file
+func Reload() error {
+	return Load(configFile, Profile)
 }
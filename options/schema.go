@@ -0,0 +1,373 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// types of option values
+const (
+	TypeString  = "string"
+	TypeInt     = "int"
+	TypeFloat   = "float"
+	TypeBool    = "bool"
+	TypeStrings = "strings"
+	// TypeDuration options are written like 90s or 2m
+	TypeDuration = "duration"
+	// TypeTable options are tables in the config file such as [groups]
+	TypeTable = "table"
+)
+
+// Key we understand in the config file
+type Key struct {
+	Name        string
+	Type        string
+	Default     interface{}
+	Description string
+	// Check the value once we know it has the right type
+	Check func(v interface{}) error
+}
+
+// Schema of every option we understand
+var Schema = []Key{
+	{Name: "save_to", Type: TypeString, Description: "Directory we save blogs to"},
+	{Name: "user_agent", Type: TypeString, Default: defaultUserAgent, Description: "User agent we send when fetching"},
+	{Name: "chrome_port", Type: TypeInt, Default: defaultChromePort, Description: "Port chrome listens on for remote control", Check: port},
+	{Name: "chrome_bin", Type: TypeString, Default: "", Description: "Chrome we launch instead of the one we find or download"},
+	{Name: "chrome_headless", Type: TypeBool, Default: true, Description: "Launch chrome without a window"},
+	{Name: "chrome_profile", Type: TypeString, Default: "", Description: "Directory chrome keeps its profile in instead of a temporary one"},
+	{Name: "devtools_url", Type: TypeString, Default: "", Description: "Attach to chrome that is already running such as ws://localhost:9222 instead of launching it"},
+	{Name: "block_urls", Type: TypeStrings, Default: defaultBlockURLs, Description: "Requests matching these patterns are not made when archiving a blog"},
+	{Name: "block_resource_types", Type: TypeStrings, Default: defaultBlockResourceTypes, Description: "Resource types we do not load when archiving a blog"},
+	{Name: "strip_snapshot", Type: TypeBool, Default: false, Description: "Leave just the article in a blog's snapshot"},
+	{Name: "rate_limit", Type: TypeFloat, Default: defaultRateLimit, Description: "Requests per second to each host", Check: positive},
+	{Name: "rate_burst", Type: TypeInt, Default: defaultRateBurst, Description: "Requests we may make at once before the rate limit applies", Check: positive},
+	{Name: "host_concurrency", Type: TypeInt, Default: defaultHostConcurrency, Description: "Requests in flight to each host", Check: positive},
+	{Name: "max_retries", Type: TypeInt, Default: defaultMaxRetries, Description: "Times we retry a request when a host is busy", Check: notNegative},
+	{Name: "respect_robots", Type: TypeBool, Default: true, Description: "Follow each host's robots.txt"},
+	{Name: "limit_rate", Type: TypeString, Default: "", Description: "Download speed limit such as 500k or 2M"},
+	{Name: "http_timeout", Type: TypeDuration, Default: defaultHTTPTimeout, Description: "Time we wait for each download", Check: positive},
+	{Name: "blog_list_timeout", Type: TypeDuration, Default: defaultBlogListTimeout, Description: "Time we wait for a list of blogs to load", Check: positive},
+	{Name: "blog_timeout", Type: TypeDuration, Default: defaultBlogTimeout, Description: "Time we wait for a blog to load", Check: positive},
+	{Name: "spider_timeout", Type: TypeDuration, Default: defaultSpiderTimeout, Description: "Time we wait for the spider to find another list of blogs before we stop", Check: positive},
+	{Name: "page_timeout", Type: TypeDuration, Default: defaultPageTimeout, Description: "Time we wait for a page to load when saving images from the web", Check: positive},
+	{Name: "pages", Type: TypeInt, Default: defaultPages, Description: "Pages we open in chrome at once when saving blogs", Check: positive},
+	{Name: "tabs", Type: TypeInt, Default: defaultTabs, Description: "Tabs we open in chrome at once when saving images from the web", Check: positive},
+	{Name: "jobs", Type: TypeInt, Default: defaultJobs, Description: "Links we save images from at once with web", Check: positive},
+	{Name: "gallery_pages", Type: TypeInt, Default: defaultGalleryPages, Description: "Pages of a gallery we follow when saving images from the web", Check: positive},
+	{Name: "proxy", Type: TypeString, Default: "", Description: "Proxy for every request such as http://proxy:8080 or socks5://localhost:1080 instead of HTTPS_PROXY", Check: proxy},
+	{Name: "no_proxy", Type: TypeStrings, Default: []string{}, Description: "Hosts, ips and cidrs we reach without the proxy"},
+	{Name: "ca_certs", Type: TypeStrings, Default: []string{}, Description: "PEM files with certificates we trust along with the system ones"},
+	{Name: "headers", Type: TypeTable, Description: "Headers we send with every request"},
+	{Name: "use_cache", Type: TypeBool, Default: true, Description: "Keep what we fetch on disk so we can fetch it again quickly"},
+	{Name: "cache_dir", Type: TypeString, Description: "Directory for the cache"},
+	{Name: "hosts", Type: TypeTable, Description: "Settings for each host as [[hosts]] tables"},
+	{Name: "nicknames", Type: TypeTable, Description: "Extra nicknames for each member"},
+	{Name: "groups", Type: TypeTable, Description: "Named lists of members"},
+	{Name: "profiles", Type: TypeTable, Description: "Options that replace the ones above when using --profile such as [profiles.nas]"},
+}
+
+// Find the key for an option
+func Find(name string) (Key, bool) {
+	name = strings.ToLower(name)
+	for _, k := range Schema {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// defaults we set by key
+var defaults = make(map[string]interface{})
+
+func setDefault(k string, value interface{}) {
+	defaults[k] = value
+	v.SetDefault(k, value)
+}
+
+// Default value of an option
+func Default(k string) interface{} {
+	return defaults[k]
+}
+
+// Value of an option as it is in the config or its default
+func Value(k string) interface{} {
+	m.RLock()
+	defer m.RUnlock()
+
+	return v.Get(k)
+}
+
+// Set an option from text such as we get on the command line and save it to the config file
+// strings are separated by commas
+// when using a profile the option is set in the profile
+func Set(name string, text string) error {
+	if loadErr != nil {
+		// saving would replace the config file we could not read
+		return loadErr
+	}
+
+	k, ok := Find(name)
+	if !ok {
+		return fmt.Errorf("%s: unknown option", name)
+	}
+	if k.Type == TypeTable {
+		return fmt.Errorf("%s: edit the config file to change a %s", k.Name, k.Type)
+	}
+	value, err := parse(k, text)
+	if err != nil {
+		return err
+	}
+	if err := check(k, value); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// we only write what is in the config file and not defaults or environment variables
+	raw := viper.New()
+	raw.SetConfigFile(configFile)
+	raw.SetConfigType(Format)
+	if err := raw.ReadInConfig(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	key := k.Name
+	if Profile != "" {
+		key = "profiles." + Profile + "." + k.Name
+	}
+	raw.Set(key, value)
+
+	if err := os.MkdirAll(filepath.Dir(configFile), 0700); err != nil {
+		return err
+	}
+	if err := raw.WriteConfigAs(configFile); err != nil {
+		return err
+	}
+
+	v.Set(k.Name, value)
+	return nil
+}
+
+// Override an option from text such as a flag until we exit
+// nothing is saved
+func Override(name string, text string) error {
+	k, ok := Find(name)
+	if !ok {
+		return fmt.Errorf("%s: unknown option", name)
+	}
+	value, err := parse(k, text)
+	if err != nil {
+		return err
+	}
+	if err := check(k, value); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	v.Set(k.Name, value)
+	return nil
+}
+
+// parse text for an option
+func parse(k Key, text string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch k.Type {
+	case TypeInt:
+		value, err = strconv.Atoi(text)
+	case TypeFloat:
+		value, err = strconv.ParseFloat(text, 64)
+	case TypeBool:
+		value, err = strconv.ParseBool(text)
+	case TypeDuration:
+		value, err = time.ParseDuration(text)
+	case TypeStrings:
+		value = strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+	default:
+		value = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q is not of type %s", k.Name, text, k.Type)
+	}
+	return value, nil
+}
+
+// Validate the options in the config file, the profile and the environment
+// each problem names the option it is about
+func Validate() []error {
+	m.RLock()
+	defer m.RUnlock()
+
+	if loadErr != nil {
+		return []error{loadErr}
+	}
+
+	var problems []error
+	seen := make(map[string]bool)
+	for _, name := range v.AllKeys() {
+		// options in a table look like groups.favorites
+		// and options in a profile look like profiles.nas.save_to
+		parts := strings.Split(name, ".")
+		prefix := ""
+		if parts[0] == "profiles" && len(parts) > 2 {
+			prefix = strings.Join(parts[:2], ".") + "."
+			parts = parts[2:]
+		}
+		top := prefix + parts[0]
+		if prefix == "" && Profile != "" && v.IsSet("profiles."+Profile+"."+parts[0]) {
+			// options from the profile are checked in the profile
+			continue
+		}
+		if seen[top] {
+			continue
+		}
+		seen[top] = true
+
+		k, ok := Find(parts[0])
+		if !ok || (prefix != "" && k.Name == "profiles") {
+			problems = append(problems, fmt.Errorf("%s: unknown option", top))
+			continue
+		}
+		if k.Type == TypeTable {
+			continue
+		}
+
+		value := v.Get(top)
+		var err error
+		if text, ok := value.(string); ok && k.Type != TypeString {
+			// environment variables are always text
+			value, err = parse(k, text)
+		}
+		if err == nil {
+			err = check(k, value)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s%s", prefix, err))
+		}
+	}
+
+	sort.Slice(problems, func(a, b int) bool {
+		return problems[a].Error() < problems[b].Error()
+	})
+
+	return problems
+}
+
+// check a value has the right type for its key and makes sense
+func check(k Key, value interface{}) error {
+	ok := false
+	switch k.Type {
+	case TypeString:
+		_, ok = value.(string)
+	case TypeInt:
+		switch value.(type) {
+		case int, int64:
+			ok = true
+		}
+	case TypeFloat:
+		switch value.(type) {
+		case float64, int, int64:
+			ok = true
+		}
+	case TypeBool:
+		_, ok = value.(bool)
+	case TypeDuration:
+		_, ok = value.(time.Duration)
+	case TypeStrings:
+		switch list := value.(type) {
+		case []string:
+			ok = true
+		case []interface{}:
+			ok = true
+			for _, e := range list {
+				if _, isString := e.(string); !isString {
+					ok = false
+				}
+			}
+		}
+	case TypeTable:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("%s: %v is not of type %s", k.Name, value, k.Type)
+	}
+
+	if k.Check != nil {
+		if err := k.Check(value); err != nil {
+			return fmt.Errorf("%s: %s", k.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func number(value interface{}) float64 {
+	switch n := value.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case time.Duration:
+		return float64(n)
+	}
+	return 0
+}
+
+func positive(value interface{}) error {
+	if number(value) <= 0 {
+		return errors.New("must be more than 0")
+	}
+	return nil
+}
+
+func notNegative(value interface{}) error {
+	if number(value) < 0 {
+		return errors.New("must not be less than 0")
+	}
+	return nil
+}
+
+func proxy(value interface{}) error {
+	text, _ := value.(string)
+	if text == "" {
+		return nil
+	}
+	u, err := url.Parse(text)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return errors.New("must be a url starting with http://, https:// or socks5://")
+	}
+	if u.Host == "" {
+		return errors.New("must have a host")
+	}
+	return nil
+}
+
+func port(value interface{}) error {
+	if n := number(value); n < 1 || n > 65535 {
+		return errors.New("must be a port from 1 to 65535")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package scrape
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bobbytrapz/hinatazaka/options"
+)
+
+// gallery keeps the images we find on each page of a gallery in order
+type gallery struct {
+	rule  *Rule
+	first string
+	// links to images in the order we found them
+	links []string
+	seen  map[string]bool
+	// pages we visited
+	visited map[string]bool
+	pages   int
+	max     int
+}
+
+func newGallery(rule *Rule, first string) *gallery {
+	return &gallery{
+		rule:    rule,
+		first:   first,
+		seen:    make(map[string]bool),
+		visited: make(map[string]bool),
+		max:     options.GetInt("gallery_pages"),
+	}
+}
+
+// add the images we found on a page
+// it is false if we should stop because the page had nothing new
+func (g *gallery) add(page string, found []string) bool {
+	g.pages++
+	g.visited[page] = true
+
+	added := 0
+	for _, u := range found {
+		u = g.rule.clean(strings.TrimSpace(u))
+		if u == "" || g.seen[u] {
+			continue
+		}
+		g.seen[u] = true
+		g.links = append(g.links, u)
+		added++
+	}
+
+	// after the first page a page with nothing new is past the end
+	return added > 0 || g.pages == 1
+}
+
+// next page to visit or empty if there is none
+// link is the next page the page gave us for rules with Next
+func (g *gallery) next(link string) string {
+	if g.pages >= g.max {
+		return ""
+	}
+	if g.rule.NextURL != "" {
+		link = g.nthPage(g.pages + 1)
+	}
+	if link == "" || g.visited[link] {
+		return ""
+	}
+	return link
+}
+
+// nthPage of the gallery using the rule's NextURL
+func (g *gallery) nthPage(n int) string {
+	base, err := url.Parse(g.first)
+	if err != nil {
+		return ""
+	}
+	u, err := base.Parse(strings.ReplaceAll(g.rule.NextURL, "{n}", strconv.Itoa(n)))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
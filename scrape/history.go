@@ -0,0 +1,101 @@
+package scrape
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bobbytrapz/hinatazaka/internal/file"
+)
+
+// HistoryFilename is the name of the history of links we saved images from in the config directory
+const HistoryFilename = "web_history.json"
+
+// History of the links we saved images from so we can skip them next time
+type History struct {
+	Links map[string]*Visit `json:"links"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Visit to a link where we saved images
+type Visit struct {
+	Saved  time.Time `json:"saved"`
+	Images int       `json:"images"`
+	SaveTo string    `json:"save_to"`
+}
+
+// LoadHistory we saved to path
+// we start a new history if there is none
+func LoadHistory(path string) (*History, error) {
+	h := &History{
+		Links: make(map[string]*Visit),
+		path:  path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scrape.LoadHistory: %w", err)
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("scrape.LoadHistory: %s: %w", path, err)
+	}
+	if h.Links == nil {
+		h.Links = make(map[string]*Visit)
+	}
+
+	return h, nil
+}
+
+// Visited gives when we saved images from a link if we have
+func (h *History) Visited(link string) (Visit, bool) {
+	if h == nil {
+		return Visit{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v, ok := h.Links[link]
+	if !ok {
+		return Visit{}, false
+	}
+	return *v, true
+}
+
+// Add a link we saved images from and write the history
+func (h *History) Add(link string, images int, saveTo string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Links[link] = &Visit{
+		Saved:  time.Now(),
+		Images: images,
+		SaveTo: saveTo,
+	}
+	h.write()
+}
+
+// write the history
+// we must hold the lock
+func (h *History) write() {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		fmt.Println("[nok]", err)
+		return
+	}
+	if err := file.Write(h.path, data, 0600); err != nil {
+		fmt.Println("[nok]", err)
+	}
+}
@@ -0,0 +1,143 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/bobbytrapz/hinatazaka/options"
+	"golang.org/x/net/html"
+)
+
+// the most html we read from a page
+const maxPageSize = 20 << 20
+
+// backgroundImage in an inline style such as background-image: url('a.jpg')
+var backgroundImage = regexp.MustCompile(`background-image\s*:\s*url\(\s*['"]?([^'")]+)['"]?\s*\)`)
+
+// NeedsBrowser is true if we need chrome to find the images
+// scripts and the width of an image only make sense in a browser
+func (r *Rule) NeedsBrowser() bool {
+	return r.Browser || r.Script != "" || r.MinWidth > 0 || r.selector == nil ||
+		(r.Next != "" && r.next == nil)
+}
+
+// findInHTML finds the images for the rule on every page of a gallery without chrome
+func findInHTML(ctx context.Context, rule *Rule, link string) ([]string, error) {
+	g := newGallery(rule, link)
+	page := link
+	for {
+		found, next, err := findInPageHTML(ctx, rule, page)
+		if err != nil {
+			// we keep what we found on the pages before
+			if g.pages == 0 {
+				return nil, err
+			}
+			log.Printf("scrape.findInHTML: %s", err)
+			break
+		}
+		if !g.add(page, found) {
+			break
+		}
+		if page = g.next(next); page == "" {
+			break
+		}
+	}
+
+	return g.links, nil
+}
+
+// findInPageHTML fetches link and finds the images for the rule
+// along with the link to the next page if there is one
+func findInPageHTML(ctx context.Context, rule *Rule, link string) (links []string, next string, err error) {
+	base, err := url.Parse(link)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", options.Get("user_agent"))
+	for k, v := range rule.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := httpClient().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: %s", link, res.Status)
+	}
+
+	doc, err := html.Parse(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %s", link, err)
+	}
+
+	// a page may say where its links are relative to
+	if el := cascadia.Query(doc, cascadia.MustCompile("base[href]")); el != nil {
+		if u, err := base.Parse(attr(el, "href")); err == nil {
+			base = u
+		}
+	}
+
+	for _, el := range cascadia.QueryAll(doc, rule.selector) {
+		var found string
+		switch rule.Attr {
+		case "background-image":
+			if m := backgroundImage.FindStringSubmatch(attr(el, "style")); m != nil {
+				found = m[1]
+			}
+		case "":
+			found = attr(el, "src")
+			if found == "" {
+				found = attr(el, "href")
+			}
+		default:
+			found = attr(el, rule.Attr)
+		}
+
+		found = strings.TrimSpace(found)
+		if found == "" {
+			continue
+		}
+		// chrome gives us absolute links so we do the same
+		u, err := base.Parse(found)
+		if err != nil {
+			continue
+		}
+		links = append(links, u.String())
+	}
+
+	if rule.next != nil {
+		// a button without a link needs chrome to click it
+		if el := cascadia.Query(doc, rule.next); el != nil {
+			if href := strings.TrimSpace(attr(el, "href")); href != "" && !strings.HasPrefix(href, "#") {
+				if u, err := base.Parse(href); err == nil && strings.HasPrefix(u.Scheme, "http") {
+					next = u.String()
+				}
+			}
+		}
+	}
+
+	return links, next, nil
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
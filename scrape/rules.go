@@ -0,0 +1,327 @@
+package scrape
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/spf13/viper"
+)
+
+// RulesFilename is the name of the rules in the config directory
+// rules there replace the rules we ship with by name
+const RulesFilename = "rules.toml"
+
+// the rules we ship with
+//
+//go:embed rules.toml
+var defaultRules []byte
+
+// Rule for finding the images on a site
+type Rule struct {
+	Name string `mapstructure:"name"`
+	// Hosts such as ray-web.jp which also matches www.ray-web.jp
+	// and *.ray-web.jp which matches every subdomain
+	Hosts []string `mapstructure:"hosts"`
+	// Path is a regular expression the path of a link must match
+	Path string `mapstructure:"path"`
+	// PathHelp is what we say when a link to the site does not match Path
+	PathHelp string `mapstructure:"path_help"`
+	// Selector for the elements with images
+	Selector string `mapstructure:"selector"`
+	// Attr we take the image from such as href
+	// background-image takes it from the style and by default we use src or href
+	Attr string `mapstructure:"attr"`
+	// MinWidth of the images we want so we skip icons and ads
+	MinWidth int `mapstructure:"min_width"`
+	// Script is javascript that gives a list of links to images instead of Selector
+	Script string `mapstructure:"script"`
+	// Rewrite each link we find
+	Rewrite []Rewrite `mapstructure:"rewrite"`
+	// StripQuery from each link we find
+	StripQuery bool `mapstructure:"strip_query"`
+	// Headers the site needs when we download its images
+	Headers map[string]string `mapstructure:"headers"`
+	// Browser is true for sites that build their pages with javascript
+	// otherwise we find images with Selector in the html without chrome
+	Browser bool `mapstructure:"browser"`
+	// Next is a selector for the link or button to the next page of a gallery
+	Next string `mapstructure:"next"`
+	// NextURL is the link to each page of a gallery after the first
+	// {n} is the page number from 2 and it is relative to the first page
+	NextURL string `mapstructure:"next_url"`
+
+	path     *regexp.Regexp
+	rewrites []*regexp.Regexp
+	// selector for the html or nil if only chrome understands it
+	selector cascadia.Selector
+	next     cascadia.Selector
+}
+
+// Rewrite replaces what matches the regular expression From with To
+// To may use $1 for what was matched by the first group
+type Rewrite struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+var rules = struct {
+	sync.Mutex
+	list   []*Rule
+	loaded bool
+}{}
+
+// RulesPath is where we keep the rules that override the ones we ship with
+func RulesPath() string {
+	return filepath.Join(options.ConfigPath, RulesFilename)
+}
+
+// LoadRules we ship with along with the ones in the config directory
+// options must be loaded first
+func LoadRules() error {
+	rules.Lock()
+	defer rules.Unlock()
+
+	return loadRules()
+}
+
+// we must hold the lock
+func loadRules() error {
+	shipped, err := parseRules(defaultRules)
+	if err != nil {
+		return fmt.Errorf("scrape.LoadRules: %s", err)
+	}
+
+	var own []*Rule
+	if options.ConfigPath != "" {
+		data, err := os.ReadFile(RulesPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("scrape.LoadRules: %s", err)
+		}
+		if own, err = parseRules(data); err != nil {
+			return fmt.Errorf("%s: %s", RulesPath(), err)
+		}
+	}
+
+	// our own rules come first so they win when both match a link
+	replaced := make(map[string]bool)
+	for _, r := range own {
+		replaced[r.Name] = true
+	}
+	list := own
+	for _, r := range shipped {
+		if !replaced[r.Name] {
+			list = append(list, r)
+		}
+	}
+
+	rules.list = list
+	rules.loaded = true
+
+	return nil
+}
+
+func parseRules(data []byte) ([]*Rule, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	var list []*Rule
+	if err := v.UnmarshalKey("rules", &list); err != nil {
+		return nil, err
+	}
+
+	for i, r := range list {
+		if err := r.compile(); err != nil {
+			if r.Name == "" {
+				return nil, fmt.Errorf("rule %d: %s", i+1, err)
+			}
+			return nil, fmt.Errorf("%s: %s", r.Name, err)
+		}
+	}
+
+	return list, nil
+}
+
+// compile a rule and check it makes sense
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return errors.New("a rule needs a name")
+	}
+	if len(r.Hosts) == 0 {
+		return errors.New("a rule needs hosts")
+	}
+	if (r.Selector == "") == (r.Script == "") {
+		return errors.New("a rule needs either a selector or a script")
+	}
+
+	if r.Next != "" && r.NextURL != "" {
+		return errors.New("a rule needs either next or next_url not both")
+	}
+	if r.NextURL != "" && !strings.Contains(r.NextURL, "{n}") {
+		return errors.New("next_url needs {n} for the page number")
+	}
+
+	if r.Path != "" {
+		re, err := regexp.Compile(r.Path)
+		if err != nil {
+			return fmt.Errorf("path: %s", err)
+		}
+		r.path = re
+	}
+	r.selector = nil
+	if r.Selector != "" {
+		if sel, err := cascadia.Compile(r.Selector); err == nil {
+			r.selector = sel
+		}
+	}
+	r.next = nil
+	if r.Next != "" {
+		if sel, err := cascadia.Compile(r.Next); err == nil {
+			r.next = sel
+		}
+	}
+	r.rewrites = nil
+	for _, rw := range r.Rewrite {
+		re, err := regexp.Compile(rw.From)
+		if err != nil {
+			return fmt.Errorf("rewrite: %s", err)
+		}
+		r.rewrites = append(r.rewrites, re)
+	}
+
+	return nil
+}
+
+// all rules loading them if we have not
+func allRules() []*Rule {
+	rules.Lock()
+	defer rules.Unlock()
+
+	if !rules.loaded {
+		if err := loadRules(); err != nil {
+			// we can still use the rules we ship with
+			rules.list, _ = parseRules(defaultRules)
+			rules.loaded = true
+		}
+	}
+
+	return rules.list
+}
+
+// FindRule for a link
+func FindRule(link string) (*Rule, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	var help string
+	for _, r := range allRules() {
+		if !r.matchHost(u.Hostname()) {
+			continue
+		}
+		if r.path != nil && !r.path.MatchString(u.Path) {
+			if help == "" {
+				help = r.PathHelp
+			}
+			continue
+		}
+		return r, nil
+	}
+
+	if help != "" {
+		return nil, errors.New(help)
+	}
+	return nil, fmt.Errorf("We cannot handle: %s", link)
+}
+
+// matchHost is true if host is one of the rule's hosts
+func (r *Rule) matchHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range r.Hosts {
+		h = strings.ToLower(h)
+		if strings.HasPrefix(h, "*.") {
+			if base := h[2:]; host == base || strings.HasSuffix(host, "."+base) {
+				return true
+			}
+			continue
+		}
+		if host == h || host == "www."+h {
+			return true
+		}
+	}
+	return false
+}
+
+// Hosts of every rule
+func Hosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, r := range allRules() {
+		for _, h := range r.Hosts {
+			h = strings.TrimPrefix(h, "*.")
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// clean up a link we found with the rule's rewrites
+func (r *Rule) clean(link string) string {
+	for i, re := range r.rewrites {
+		link = re.ReplaceAllString(link, r.Rewrite[i].To)
+	}
+	if r.StripQuery {
+		if i := strings.IndexAny(link, "?#"); i >= 0 {
+			link = link[:i]
+		}
+	}
+	return link
+}
+
+// jsFindBySelector gives the links to images in the elements that match a selector
+const jsFindBySelector = `(selector, attr, minWidth) => [...document.querySelectorAll(selector)]
+	.filter(el => !minWidth || el.width >= minWidth)
+	.map(el => {
+		if (attr === 'background-image') {
+			return el.style.backgroundImage.slice(5, -2);
+		}
+		if (attr) {
+			return el[attr] || el.getAttribute(attr);
+		}
+		return el.src || el.href;
+	})
+	.filter(Boolean)
+	.join('\n')`
+
+// js that finds the links to images for the rule with its arguments
+// links are separated by new lines
+func (r *Rule) js() (string, []interface{}) {
+	if r.Script != "" {
+		return `() => {
+	const found = (` + r.Script + `);
+	return (Array.isArray(found) ? found : String(found).split(',')).filter(Boolean).join('\n');
+}`, nil
+	}
+	return jsFindBySelector, []interface{}{r.Selector, r.Attr, r.MinWidth}
+}
@@ -4,130 +4,274 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
-	"github.com/bobbytrapz/gochrome"
+	"github.com/bobbytrapz/hinatazaka/browser"
+	"github.com/bobbytrapz/hinatazaka/fetch"
 	"github.com/bobbytrapz/hinatazaka/options"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
 )
 
-var httpClient = http.Client{
-	Timeout: 60 * time.Second,
+var transport = fetch.NewCache(fetch.NewTransport(nil))
+
+// httpClient waits as long as the http_timeout option says
+func httpClient() *http.Client {
+	return &http.Client{
+		Timeout:   options.GetDuration("http_timeout"),
+		Transport: transport,
+	}
 }
 
-// NumTabWorkersPerMember decides how many tabs to open for each blog spider
-var NumTabWorkersPerMember = 8
+// tabs holds a place for each tab we have open so we keep to the tabs option
+var tabs chan struct{}
+var tabsOnce sync.Once
 
-// SaveTo decides where we save everything that we find
-var SaveTo = options.Get("save_to")
+// SaveImagesFrom a webpage using the rule for its site and gives how many we saved
+// we look in the html first and only open a tab in chrome if the rule needs it
+// or the html has no images
+func SaveImagesFrom(ctx context.Context, rule *Rule, link string, saveTo string) (int, error) {
+	if !rule.NeedsBrowser() {
+		links, err := findInHTML(ctx, rule, link)
+		if err != nil {
+			log.Printf("scrape.SaveImagesFrom: %s: html: %s", rule.Name, err)
+		}
+		if len(links) > 0 {
+			return saveImages(ctx, rule, link, links, saveTo)
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		log.Printf("scrape.SaveImagesFrom: %s: no images in the html so we try chrome", rule.Name)
+	}
 
-// ResJSString is a response
-type ResJSString struct {
-	Result struct {
-		Type  string `json:"type"`
-		Value string `json:"value"`
-	} `json:"result"`
-}
+	tabsOnce.Do(func() {
+		tabs = make(chan struct{}, options.GetInt("tabs"))
+	})
+	select {
+	case tabs <- struct{}{}:
+		defer func() { <-tabs }()
+	case <-ctx.Done():
+		return 0, fmt.Errorf("scrape.SaveImagesFrom: %s", ctx.Err())
+	}
 
-// ResJSInt is a response
-type ResJSInt struct {
-	Result struct {
-		Type  string `json:"type"`
-		Value int    `json:"value"`
-	} `json:"result"`
-}
+	page, err := browser.Page()
+	if err != nil {
+		return 0, fmt.Errorf("scrape.SaveImagesFrom: %s", err)
+	}
+	defer page.Close()
 
-// ResJSFloat32 is a response
-type ResJSFloat32 struct {
-	Result struct {
-		Type  string  `json:"type"`
-		Value float32 `json:"value"`
-	} `json:"result"`
+	return SaveImagesFromPage(ctx, page, rule, link, saveTo)
 }
 
-// SaveImagesFrom a webpage
-func SaveImagesFrom(ctx context.Context, browser *gochrome.Browser, link string, saveImagesTo string, jsCode string) error {
-	tab, err := browser.NewTab(ctx)
+// SaveImagesFromPage visits link then uses the rule to find urls for images
+// then it downloads each image and gives how many we saved
+func SaveImagesFromPage(ctx context.Context, page *rod.Page, rule *Rule, link string, saveTo string) (int, error) {
+	links, err := findInPage(ctx, page, rule, link)
 	if err != nil {
-		return fmt.Errorf("scrape.SaveImagesFrom: %s", err)
+		return 0, fmt.Errorf("scrape.SaveImagesFromPage: %s", err)
 	}
-	defer tab.Close()
-	SaveImagesFromTabWith(ctx, tab, link, saveImagesTo, jsCode)
-	return nil
+
+	return saveImages(ctx, rule, link, links, saveTo)
 }
 
-// SaveImagesFromTabWith sends given javascript to get urls for images
-// then it downloads each image from a list of comma-separated urls
-func SaveImagesFromTabWith(ctx context.Context, tab *gochrome.Tab, link string, saveTo string, jsCode string) {
-	_, err := tab.Goto(link)
-	if err != nil {
-		panic(err)
-	}
-	tab.WaitForLoad(10 * time.Second)
+// findInPage visits link in chrome and finds the images for the rule
+// on every page of a gallery
+func findInPage(ctx context.Context, page *rod.Page, rule *Rule, link string) ([]string, error) {
+	page = page.Context(ctx)
 
-	got, err := tab.Evaluate(jsCode)
-	if err != nil {
-		panic(err)
+	if len(rule.Headers) > 0 {
+		// extra headers replace the ones chrome was given so we send ours too
+		headers := fetch.Headers()
+		for k, v := range rule.Headers {
+			headers[http.CanonicalHeaderKey(k)] = v
+		}
+		var dict []string
+		for k, v := range headers {
+			dict = append(dict, k, v)
+		}
+		if _, err := page.SetExtraHeaders(dict); err != nil {
+			return nil, fmt.Errorf("headers: %s", err)
+		}
 	}
 
-	value, ok := got.Result["value"]
-	if !ok {
-		gochrome.Log("scrape.SaveImagesFromTabWith: no images")
-		return
+	g := newGallery(rule, link)
+	current := link
+	if err := visit(page, current); err != nil {
+		return nil, err
 	}
-	links := value.(string)
-	gochrome.Log("scrape.SaveImagesFromTabWith: links: %+v", links)
-
-	count := 0
-	for _, u := range strings.Split(links, ",") {
-		if u == "" {
-			continue
+	for {
+		js, args := rule.js()
+		got, err := page.Eval(js, args...)
+		if err != nil {
+			if g.pages == 0 {
+				return nil, fmt.Errorf("%s: %s", current, err)
+			}
+			log.Printf("scrape.findInPage: %s: %s", current, err)
+			break
+		}
+		if !g.add(current, strings.Split(got.Value.String(), "\n")) {
+			break
 		}
 
-		purl, err := url.Parse(u)
-		if err != nil {
-			gochrome.Log("scrape.SaveImagesFromTabWith: %s", err)
-			fmt.Println("[nok]", err)
+		if rule.Next == "" {
+			if current = g.next(""); current == "" {
+				break
+			}
+			if err := visit(page, current); err != nil {
+				log.Printf("scrape.findInPage: %s", err)
+				break
+			}
 			continue
 		}
-		fn := filepath.Join(saveTo, filepath.Base(purl.Path))
 
-		req, err := http.NewRequest("GET", u, nil)
+		// the next page is a link or a button we click
+		got, err = page.Eval(jsNext, rule.Next)
 		if err != nil {
-			err = fmt.Errorf("scrape.SaveImagesFromTabWith: %s", err)
-			return
+			log.Printf("scrape.findInPage: %s: next: %s", current, err)
+			break
 		}
-		req = req.WithContext(ctx)
-
-		res, err := httpClient.Do(req)
-		if err != nil {
-			gochrome.Log("scrape.SaveImagesFromTabWith: %s", err)
-			fmt.Println("[nok]", err)
+		if got.Value.Nil() {
+			// there is no next page
+			break
+		}
+		if next := got.Value.String(); next != "" {
+			if current = g.next(next); current == "" {
+				break
+			}
+			if err := visit(page, current); err != nil {
+				log.Printf("scrape.findInPage: %s", err)
+				break
+			}
 			continue
 		}
+		if g.pages >= g.max {
+			break
+		}
+		if err := clickNext(page, rule.Next); err != nil {
+			log.Printf("scrape.findInPage: %s: next: %s", current, err)
+			break
+		}
+		// each page we get by clicking is named by how many clicks it took
+		current = fmt.Sprintf("%s#%d", link, g.pages+1)
+	}
 
-		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			gochrome.Log("scrape.SaveImagesFromTabWith: %s", err)
-			fmt.Println("[nok]", err)
-			continue
+	return g.links, nil
+}
+
+// jsNext gives the link to the next page, empty if it is a button or null if there is none
+const jsNext = `(selector) => {
+	const el = document.querySelector(selector);
+	if (!el) {
+		return null;
+	}
+	const href = el.href || '';
+	return href.startsWith('http') && !href.includes('#') ? href : '';
+}`
+
+// visit link and wait for the page to load and settle
+func visit(page *rod.Page, link string) error {
+	// the page has page_timeout to load
+	timeout := options.GetDuration("page_timeout")
+	p := page.Timeout(timeout)
+	if err := p.Navigate(link); err != nil {
+		return fmt.Errorf("%s: %s", link, err)
+	}
+	if err := p.WaitLoad(); err != nil {
+		return fmt.Errorf("%s: %s", link, err)
+	}
+	// many pages add their images once they load so we give them a moment
+	if err := p.WaitIdle(timeout); err != nil {
+		log.Printf("scrape.visit: %s: wait idle: %s", link, err)
+	}
+	return nil
+}
+
+// clickNext clicks the button for the next page and waits for it to settle
+func clickNext(page *rod.Page, selector string) error {
+	timeout := options.GetDuration("page_timeout")
+	p := page.Timeout(timeout)
+	el, err := p.Element(selector)
+	if err != nil {
+		return err
+	}
+	if err := el.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return err
+	}
+	if err := p.WaitIdle(timeout); err != nil {
+		log.Printf("scrape.clickNext: wait idle: %s", err)
+	}
+	return nil
+}
+
+// saveImages we found on link and give how many we saved
+func saveImages(ctx context.Context, rule *Rule, link string, links []string, saveTo string) (int, error) {
+	log.Printf("scrape.saveImages: %s: links: %+v", rule.Name, links)
+
+	count := 0
+	for _, u := range links {
+		if ctx.Err() != nil {
+			break
 		}
 
-		fmt.Println("[save]", fn)
-		_, err = io.Copy(f, res.Body)
-		if err != nil {
-			gochrome.Log("scrape.SaveImagesFromTabWith: %s", err)
+		if err := saveImage(ctx, u, saveTo, rule.Headers); err != nil {
+			log.Printf("scrape.saveImages: %s", err)
 			fmt.Println("[nok]", err)
+			continue
 		}
 		count++
-
-		f.Close()
-		res.Body.Close()
 	}
 
 	fmt.Printf("[saved] %d images\n", count)
+	if count == 0 {
+		return 0, fmt.Errorf("We found no images on %s", link)
+	}
+
+	return count, ctx.Err()
+}
+
+// saveImage from link to the directory saveTo
+func saveImage(ctx context.Context, link string, saveTo string, headers map[string]string) error {
+	purl, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(saveTo, filepath.Base(purl.Path))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", options.Get("user_agent"))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", link, res.Status)
+	}
+
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Println("[save]", fn)
+	if _, err := io.Copy(f, res.Body); err != nil {
+		return err
+	}
+
+	return f.Close()
 }